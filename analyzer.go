@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SUFFIX_JSONL        = ".jsonl"
+	SUFFIX_MASKED_JSONL = "-masked.jsonl" // Output of pimo, analyzed as the target of the masking
+	TARGET_ANALYZE_FILE = "target-analyze.yaml"
+	ANALYZE_SAMPLES     = 5       // Samples kept by column, and by string length
+	ANALYZE_MAX_ROW     = 1 << 24 // Longest JSON line read, in bytes
+)
+
+// Metrics of an analyze.yaml file, in the format lino analyse writes and parseAnalyze reads.
+type (
+	analyzeMetricsOutput struct {
+		Count   int           `yaml:"count"`
+		Empty   int           `yaml:"empty"`
+		Nulls   int           `yaml:"nulls"`
+		Min     interface{}   `yaml:"min,omitempty"`
+		Max     interface{}   `yaml:"max,omitempty"`
+		Samples []interface{} `yaml:"samples,omitempty"`
+	}
+	analyzeLengthOutput struct {
+		Length  int                  `yaml:"length"`
+		Freq    float64              `yaml:"freq"`
+		Metrics analyzeMetricsOutput `yaml:"metrics"`
+	}
+	analyzeColumnOutput struct {
+		Name   string `yaml:"name"`
+		Type   string `yaml:"type"` // string, numeric or bool
+		Config struct {
+			Concept      string   `yaml:"concept"`
+			Constraint   []string `yaml:"constraint"`
+			Confidential *bool    `yaml:"confidential"`
+		} `yaml:"config"`
+		MainMetric   analyzeMetricsOutput `yaml:"mainMetric"`
+		StringMetric *struct {
+			MinLen   int                   `yaml:"minLen"`
+			MaxLen   int                   `yaml:"maxLen"`
+			CountLen int                   `yaml:"countLen"`
+			Lengths  []analyzeLengthOutput `yaml:"lengths"`
+		} `yaml:"stringMetric,omitempty"`
+		NumericMetric *struct {
+			Mean float64 `yaml:"mean"`
+		} `yaml:"numericMetric,omitempty"`
+		BoolMetric *struct {
+			TrueRatio float64 `yaml:"trueRatio"`
+		} `yaml:"boolMetric,omitempty"`
+	}
+	analyzeTableOutput struct {
+		Name    string                `yaml:"name"`
+		Columns []analyzeColumnOutput `yaml:"columns"`
+	}
+	analyzeOutput struct {
+		Database string               `yaml:"database"`
+		Tables   []analyzeTableOutput `yaml:"tables"`
+	}
+)
+
+// AnalyzedFile is a JSONL file analyzed as a table.
+type AnalyzedFile struct {
+	File    string `json:"file"`
+	Table   string `json:"table"`
+	Rows    int    `json:"rows"`
+	Columns int    `json:"columns"`
+}
+
+// AnalyzeReport is the result of the analysis of the JSONL files of a folder.
+type AnalyzeReport struct {
+	File   string         `json:"file"` // Workspace path of the written analyze file
+	Tables []AnalyzedFile `json:"tables"`
+}
+
+// valueStats accumulates the metrics of a set of values.
+type valueStats struct {
+	count, empty int
+	min, max     interface{}
+	samples      []interface{}
+}
+
+// add accounts a non-null value, compared by less.
+func (s *valueStats) add(value interface{}, less func(a, b interface{}) bool) {
+	s.count++
+	if isZeroValue(value) {
+		s.empty++
+	}
+	if s.min == nil || less(value, s.min) {
+		s.min = value
+	}
+	if s.max == nil || less(s.max, value) {
+		s.max = value
+	}
+	if len(s.samples) < ANALYZE_SAMPLES {
+		s.samples = append(s.samples, value)
+	}
+}
+
+// output renders the metrics, out of count values of which nulls are null.
+func (s *valueStats) output(nulls int) analyzeMetricsOutput {
+	return analyzeMetricsOutput{Count: s.count + nulls, Empty: s.empty, Nulls: nulls, Min: s.min, Max: s.max, Samples: s.samples}
+}
+
+// columnStats accumulates the metrics of a column, for each type its values may end up with.
+type columnStats struct {
+	name           string
+	numbers, bools int
+	sum            float64
+	trues          int
+	numeric, text  valueStats // The values as numbers, and as text
+	boolean        valueStats
+	lengths        map[int]*valueStats
+}
+
+// add accounts a non-null value of the column.
+func (c *columnStats) add(value interface{}) {
+	text := fmt.Sprint(value)
+	switch v := value.(type) {
+	case float64:
+		c.numbers++
+		c.sum += v
+		c.numeric.add(value, func(a, b interface{}) bool { return toFloat64(a) < toFloat64(b) })
+	case int64:
+		c.numbers++
+		c.sum += float64(v)
+		c.numeric.add(value, func(a, b interface{}) bool { return toFloat64(a) < toFloat64(b) })
+	case bool:
+		c.bools++
+		if v {
+			c.trues++
+		}
+		c.boolean.add(value, func(a, b interface{}) bool { return !a.(bool) && b.(bool) })
+	case string:
+	default:
+		encoded, _ := json.Marshal(value) // Arrays and empty objects
+		text = string(encoded)
+	}
+	less := func(a, b interface{}) bool { return a.(string) < b.(string) }
+	c.text.add(text, less)
+	length := utf8.RuneCountInString(text)
+	if c.lengths[length] == nil {
+		c.lengths[length] = &valueStats{}
+	}
+	c.lengths[length].add(text, less)
+}
+
+// output renders the metrics of the column, out of rows rows.
+func (c *columnStats) output(rows int) analyzeColumnOutput {
+	out := analyzeColumnOutput{Name: c.name}
+	out.Config.Constraint = []string{}
+	nulls := rows - c.text.count
+	switch {
+	case c.text.count > 0 && c.numbers == c.text.count:
+		out.Type = "numeric"
+		out.MainMetric = c.numeric.output(nulls)
+		out.NumericMetric = &struct {
+			Mean float64 `yaml:"mean"`
+		}{Mean: c.sum / float64(c.numbers)}
+	case c.text.count > 0 && c.bools == c.text.count:
+		out.Type = "bool"
+		out.MainMetric = c.boolean.output(nulls)
+		out.MainMetric.Min, out.MainMetric.Max = nil, nil
+		out.BoolMetric = &struct {
+			TrueRatio float64 `yaml:"trueRatio"`
+		}{TrueRatio: float64(c.trues) / float64(c.bools)}
+	default:
+		out.Type = "string"
+		out.MainMetric = c.text.output(nulls)
+		lengths := make([]int, 0, len(c.lengths))
+		for length := range c.lengths {
+			lengths = append(lengths, length)
+		}
+		sort.Slice(lengths, func(i, j int) bool {
+			a, b := c.lengths[lengths[i]], c.lengths[lengths[j]]
+			return a.count > b.count || a.count == b.count && lengths[i] < lengths[j]
+		})
+		metric := &struct {
+			MinLen   int                   `yaml:"minLen"`
+			MaxLen   int                   `yaml:"maxLen"`
+			CountLen int                   `yaml:"countLen"`
+			Lengths  []analyzeLengthOutput `yaml:"lengths"`
+		}{CountLen: len(lengths), Lengths: []analyzeLengthOutput{}}
+		for i, length := range lengths {
+			if i == 0 || length < metric.MinLen {
+				metric.MinLen = length
+			}
+			if length > metric.MaxLen {
+				metric.MaxLen = length
+			}
+			metric.Lengths = append(metric.Lengths, analyzeLengthOutput{
+				Length:  length,
+				Freq:    float64(c.lengths[length].count) / float64(c.text.count),
+				Metrics: c.lengths[length].output(0),
+			})
+		}
+		if c.text.count > 0 {
+			out.StringMetric = metric
+		}
+	}
+	return out
+}
+
+// isZeroValue tells whether a value is empty, as lino counts them: "", false or 0.
+func isZeroValue(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	}
+	return false
+}
+
+// toFloat64 converts an analyzed number.
+func toFloat64(value interface{}) float64 {
+	if v, ok := value.(int64); ok {
+		return float64(v)
+	}
+	return value.(float64)
+}
+
+// analyzedValue converts a decoded JSON number to an integer when it is one.
+func analyzedValue(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	f, _ := number.Float64()
+	return f
+}
+
+// jsonKeys returns the keys of a JSON object in the order they are written, nil when it is not an object.
+func jsonKeys(line string) []string {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	keys := []string{}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return keys
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return keys
+		}
+		keys = append(keys, token.(string))
+	}
+	return keys
+}
+
+// analyzeJSONL computes the metrics of a table from its rows, one JSON object per line.
+// Nested objects are analyzed field by field, as columns named like "address.city".
+func analyzeJSONL(table string, r io.Reader) (analyzeTableOutput, int, error) {
+	columns := map[string]*columnStats{}
+	order := []string{}
+	rows := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), ANALYZE_MAX_ROW)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return analyzeTableOutput{}, rows, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows++
+		for _, key := range jsonKeys(text) {
+			fields := map[string]interface{}{}
+			flattenFields(key, row[key], fields)
+			paths := make([]string, 0, len(fields))
+			for path := range fields {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			for _, path := range paths {
+				column, ok := columns[path]
+				if !ok {
+					column = &columnStats{name: path, lengths: map[int]*valueStats{}}
+					columns[path] = column
+					order = append(order, path)
+				}
+				if fields[path] != nil {
+					column.add(analyzedValue(fields[path]))
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return analyzeTableOutput{}, rows, err
+	}
+
+	out := analyzeTableOutput{Name: table, Columns: []analyzeColumnOutput{}}
+	for _, name := range order {
+		out.Columns = append(out.Columns, columns[name].output(rows))
+	}
+	return out, rows, nil
+}
+
+// jsonlTableName returns the table of a JSONL file, named after it: "owners.jsonl" holds the rows of "owners",
+// and "owners-masked.jsonl" the masked rows of "owners".
+func jsonlTableName(file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), SUFFIX_MASKED_JSONL), SUFFIX_JSONL)
+}
+
+// jsonlFiles lists the JSONL files given, directories standing for the JSONL files they hold:
+// the masked ones for a target analysis, the others otherwise.
+func jsonlFiles(paths []string, target bool) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*"+SUFFIX_JSONL))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if strings.HasSuffix(match, SUFFIX_MASKED_JSONL) == target {
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// analyzeJSONLFiles analyzes JSONL files, one table each, and renders their analyze.yaml.
+func analyzeJSONLFiles(database string, files []string, tableName func(file string) string) ([]byte, []AnalyzedFile, error) {
+	out := analyzeOutput{Database: database, Tables: []analyzeTableOutput{}}
+	analyzed := []AnalyzedFile{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		table, rows, err := analyzeJSONL(tableName(file), f)
+		f.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		out.Tables = append(out.Tables, table)
+		analyzed = append(analyzed, AnalyzedFile{File: file, Table: table.Name, Rows: rows, Columns: len(table.Columns)})
+	}
+	content, err := yaml.Marshal(out)
+	return content, analyzed, err
+}
+
+// refreshTargetAnalysis analyzes the masked JSONL files of a folder as its target-analyze.yaml,
+// which is left untouched when its metrics did not change.
+func refreshTargetAnalysis(ws *Workspace, folderDir string, files []string) ([]AnalyzedFile, error) {
+	content, analyzed, err := analyzeJSONLFiles("target", files, jsonlTableName)
+	if err != nil {
+		return nil, err
+	}
+	err = ws.UpdateFileAt(filepath.Join(folderDir, TARGET_ANALYZE_FILE), func([]byte, bool) ([]byte, error) {
+		return content, nil
+	})
+	return analyzed, err
+}
+
+// analyzeCommand runs `nino analyze`, writing the analyze.yaml of JSONL files.
+func analyzeCommand(args []string) error {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	output := flags.String("o", "", "Analyze file to write, - for the standard output. Defaults to analyze.yaml, or target-analyze.yaml with -target.")
+	database := flags.String("database", "", "Database name written in the analyze file. Defaults to source, or target with -target.")
+	target := flags.Bool("target", false, "Analyze the masked files of the directories (*-masked.jsonl) instead of the others.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s analyze [-target] [-o analyze.yaml] [-database name] <files or directories...>\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Analyzes JSONL files, one table each named after its file, like lino analyse does a database.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	defaultOutput, defaultDatabase := "analyze.yaml", "source"
+	if *target {
+		defaultOutput, defaultDatabase = TARGET_ANALYZE_FILE, "target"
+	}
+	if *output == "" {
+		*output = defaultOutput
+	}
+	if *database == "" {
+		*database = defaultDatabase
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing JSONL files")
+	}
+
+	files, err := jsonlFiles(flags.Args(), *target)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no JSONL file found")
+	}
+	content, analyzed, err := analyzeJSONLFiles(*database, files, jsonlTableName)
+	if err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	if err := writeFileAtomic(*output, content); err != nil {
+		return err
+	}
+	for _, file := range analyzed {
+		fmt.Printf("%-30s %8d rows %4d columns  %s\n", file.Table, file.Rows, file.Columns, file.File)
+	}
+	return nil
+}
+
+// analyzeHandler analyzes the JSONL files of a folder, or of its ?source= sub-directory, and writes
+// them as the ?output= analyze file of the folder (analyze.yaml by default). With ?target=true, the
+// masked files are analyzed instead, as target-analyze.yaml by default.
+func analyzeHandler(store *ProjectStore, ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		target := r.URL.Query().Get("target") == "true"
+		database, output := "source", "analyze.yaml"
+		if target {
+			database, output = "target", TARGET_ANALYZE_FILE
+		}
+		if value := r.URL.Query().Get("output"); value != "" {
+			output = value
+		}
+		// Any other file would be overwritten, and then parsed as something else than an analysis.
+		if kind := schemaKind(output); filepath.Base(output) != output || (kind != KIND_ANALYZE && kind != KIND_TARGET_ANALYZE) {
+			http.Error(w, fmt.Sprintf("output must be analyze.yaml or %s", TARGET_ANALYZE_FILE), http.StatusBadRequest)
+			return
+		}
+		folderDir, err := ws.FolderDir(folderName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		sourceDir := filepath.Join(folderDir, r.URL.Query().Get("source"))
+		if !ws.Contains(sourceDir) {
+			http.Error(w, fmt.Sprintf("source '%s' is not in the workspace", r.URL.Query().Get("source")), http.StatusForbidden)
+			return
+		}
+
+		files, err := jsonlFiles([]string{sourceDir}, target)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if len(files) == 0 {
+			http.Error(w, fmt.Sprintf("no JSONL file in '%s'", sourceDir), http.StatusNotFound)
+			return
+		}
+		content, analyzed, err := analyzeJSONLFiles(database, files, jsonlTableName)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to analyze: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		outputPath := filepath.Join(folderDir, output)
+		if err := ws.WriteFileAt(outputPath, content, true); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to write analyze file: %v", err), workspaceErrorStatus(err))
+			return
+		}
+		log.Printf("analyzeHandler: analyzed %d JSONL files into %s", len(files), outputPath)
+		reloadSchemas(store)
+
+		report := AnalyzeReport{Tables: analyzed}
+		report.File, _ = ws.RelPath(outputPath)
+		for i := range report.Tables {
+			report.Tables[i].File, _ = ws.RelPath(report.Tables[i].File)
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Failed to encode analyze report to JSON: %v", err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// parsedFile is the cached result of parsing one YAML file.
+type parsedFile struct {
+	basePath string
+	folder   string // Folder key the file contributes to
+	kind     string
+	modTime  time.Time
+	size     int64
+	hash     string      // sha256 of the content
+	value    interface{} // Decoded schema, nil when the file could not be parsed
+	err      error
+	problems []string // Validation problems of the decoded schema
+}
+
+// FileStatus is the parse result of one YAML file, as shown in the file tree.
+type FileStatus struct {
+	Kind     string
+	Error    string   // Read or parse error, empty when the file was parsed
+	Problems []string // Validation problems, see validateSchema
+}
+
+// schemaCache keeps every parsed file keyed by path, so a reload only re-parses
+// the files whose modification time, size and finally content hash changed.
+// It is not safe for concurrent use: the project store serializes its reloads.
+type schemaCache struct {
+	files map[string]*parsedFile
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{files: make(map[string]*parsedFile)}
+}
+
+// update brings the cache in line with fileMap and returns the project data along with the changed files.
+// Folders without any changed file keep the very same *FolderData as in previous,
+// the others are rebuilt by merging their cached files.
+func (c *schemaCache) update(fileMap map[string]string, previous ProjectData) (ProjectData, []string) {
+	dirtyFolders := make(map[string]bool)
+	changed := []string{}
+
+	for file := range c.files {
+		if _, ok := fileMap[file]; !ok {
+			dirtyFolders[c.files[file].folder] = true
+			changed = append(changed, file)
+			delete(c.files, file)
+		}
+	}
+	for file, basePath := range fileMap {
+		if cached, ok := c.files[file]; ok && cached.basePath != basePath {
+			dirtyFolders[cached.folder] = true // The file moves to another folder.
+		}
+		entry, reparsed := c.refresh(file, basePath)
+		if reparsed {
+			dirtyFolders[entry.folder] = true
+			changed = append(changed, file)
+		}
+	}
+	sort.Strings(changed)
+
+	// Merge files in a stable order, so that appends (tables) do not depend on map iteration.
+	// SQLite databases come last, so that the YAML files of their folder take precedence.
+	files := make([]string, 0, len(c.files))
+	for file := range c.files {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		iDatabase, jDatabase := c.files[files[i]].kind == KIND_SQLITE, c.files[files[j]].kind == KIND_SQLITE
+		if iDatabase != jDatabase {
+			return jDatabase
+		}
+		return files[i] < files[j]
+	})
+
+	projectData := make(ProjectData)
+	for _, file := range files {
+		entry := c.files[file]
+		if folder, ok := previous[entry.folder]; ok && !dirtyFolders[entry.folder] {
+			projectData[entry.folder] = folder
+			continue
+		}
+		// Ensure a FolderData struct exists for the current path.
+		if _, ok := projectData[entry.folder]; !ok {
+			projectData[entry.folder] = &FolderData{
+				Maskings: make(map[string]MaskingSchema),
+			}
+		}
+		if entry.value != nil {
+			applySchema(projectData[entry.folder], file, entry.kind, entry.value)
+		}
+	}
+	return projectData, changed
+}
+
+// refresh re-parses a file if needed. It returns its cache entry and whether its content changed.
+func (c *schemaCache) refresh(file, basePath string) (*parsedFile, bool) {
+	info, err := os.Stat(file)
+	cached, ok := c.files[file]
+	if ok && err == nil && cached.basePath == basePath && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached, false
+	}
+
+	entry := &parsedFile{basePath: basePath, folder: folderKey(file, basePath), kind: schemaKind(file)}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		entry.err = err
+	} else {
+		sum := sha256.Sum256(content)
+		entry.hash = hex.EncodeToString(sum[:])
+	}
+	if info != nil {
+		entry.modTime, entry.size = info.ModTime(), info.Size()
+	}
+
+	// A touched but identical file only needs its new stamp.
+	if ok && cached.err == nil && entry.err == nil && cached.hash == entry.hash && cached.basePath == basePath {
+		cached.modTime, cached.size = entry.modTime, entry.size
+		return cached, false
+	}
+
+	if entry.err == nil {
+		log.Printf("File: %s, BasePath: %s, RelPath: %s", file, basePath, entry.folder)
+		entry.value, entry.err = decodeSchema(file, entry.kind, content)
+	}
+	if entry.err == nil {
+		entry.problems = validateSchema(entry.kind, entry.value)
+	}
+	c.files[file] = entry
+	return entry, true
+}
+
+// statuses returns the parse result of every cached file, keyed by absolute path with symlinks evaluated,
+// so that they can be matched with the workspace paths.
+func (c *schemaCache) statuses() map[string]FileStatus {
+	statuses := make(map[string]FileStatus, len(c.files))
+	for file, entry := range c.files {
+		fullPath, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		if real, err := filepath.EvalSymlinks(fullPath); err == nil {
+			fullPath = real
+		}
+		status := FileStatus{Kind: entry.kind, Problems: entry.problems}
+		if entry.err != nil {
+			status.Error = entry.err.Error()
+		}
+		statuses[fullPath] = status
+	}
+	return statuses
+}
+
+// hash returns a content hash over the sorted file paths and their content hashes.
+func (c *schemaCache) hash() string {
+	files := make([]string, 0, len(c.files))
+	for file := range c.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		io.WriteString(h, file+"\x00"+c.files[file].hash+"\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
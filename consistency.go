@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Problems of a foreign key whose masking does not follow the masking of the key it references.
+const (
+	CONSISTENCY_UNMASKED_PARENT      = "unmasked-parent"      // The foreign key is masked, the key it references is not
+	CONSISTENCY_UNMASKED_CHILD       = "unmasked-child"       // The key is masked, the foreign key referencing it is not
+	CONSISTENCY_DIFFERENT_MASKS      = "different-masks"      // The key and the foreign key use different mask types
+	CONSISTENCY_DIFFERENT_PARAMETERS = "different-parameters" // Same mask types, with different parameters
+	CONSISTENCY_NO_SHARED_CACHE      = "no-shared-cache"      // Random masks without a cache shared by the key and the foreign key
+	CONSISTENCY_DIFFERENT_SEED       = "different-seed"       // Seeded masks, in masking files with different seeds
+)
+
+var (
+	// keyedMasks give the same output for the same input whatever the seed.
+	keyedMasks = []string{"ff1", "constant", "fromCache"}
+	// seededMasks give the same output for the same input and the same seed.
+	seededMasks = []string{"hash", "hashInUri"}
+)
+
+// ConsistencyIssue is a key and a foreign key referencing it whose masked values may not match anymore.
+type ConsistencyIssue struct {
+	Relation   string `json:"relation"`
+	Parent     string `json:"parent"`               // Referenced key, as "table.column"
+	Child      string `json:"child"`                // Foreign key, as "table.column"
+	ParentMask string `json:"parentMask,omitempty"` // Mask types of the key, e.g. "randomInt"
+	ChildMask  string `json:"childMask,omitempty"`  // Mask types of the foreign key
+	Problem    string `json:"problem"`              // See CONSISTENCY_*
+	Message    string `json:"message"`
+}
+
+// ConsistencyReport lists the consistency issues of the relations of a folder.
+type ConsistencyReport struct {
+	Folder    string             `json:"folder"`
+	Relations int                `json:"relations"` // Number of relations checked
+	Issues    []ConsistencyIssue `json:"issues"`
+}
+
+// maskedColumn is the masking rule of a column, with the seed of its masking file.
+type maskedColumn struct {
+	name  string // "table.column"
+	rule  *MaskingRule
+	masks []map[string]interface{}
+	seed  int
+}
+
+// kinds returns the mask types of the column, e.g. "add-transient+template".
+func (col maskedColumn) kinds() string {
+	kinds := []string{}
+	for _, mask := range col.masks {
+		types := make([]string, 0, len(mask))
+		for kind := range mask {
+			types = append(types, kind)
+		}
+		sort.Strings(types)
+		kinds = append(kinds, types...)
+	}
+	return strings.Join(kinds, "+")
+}
+
+// findMaskingRule returns the rule of a masking file selecting a column, or nil.
+func findMaskingRule(schema MaskingSchema, column string) *MaskingRule {
+	for i, rule := range schema.Masking {
+		if name, field := rule.selector(); name == column && field == "" {
+			return &schema.Masking[i]
+		}
+	}
+	return nil
+}
+
+// lookupMaskedColumn finds the masking rule of a column of a table, in the folder of the table.
+func lookupMaskedColumn(projectData ProjectData, tableToFolder map[string]string, table, column string) maskedColumn {
+	col := maskedColumn{name: table + "." + column}
+	folder, ok := projectData[tableToFolder[table]]
+	if !ok {
+		return col
+	}
+	schema, ok := folder.Maskings[table]
+	if !ok {
+		return col
+	}
+	col.seed = schema.Seed
+	if col.rule = findMaskingRule(schema, column); col.rule != nil {
+		col.masks = col.rule.pimoMasks()
+		if seed, ok := col.rule.Seed.(int); ok {
+			col.seed = seed
+		}
+	}
+	return col
+}
+
+// checkConsistency cross-checks the relations of a folder against the masking files of their tables:
+// the masked values of a foreign key must stay equal to the masked values of the key it references.
+func checkConsistency(projectData ProjectData, folderName string) ConsistencyReport {
+	report := ConsistencyReport{Folder: folderName, Issues: []ConsistencyIssue{}}
+	folder, ok := projectData[folderName]
+	if !ok {
+		return report
+	}
+
+	// Tables of the folder first, relations may reference tables of other folders.
+	tableToFolder := make(map[string]string)
+	for name, data := range projectData {
+		for _, table := range data.Tables {
+			if _, seen := tableToFolder[table.Name]; !seen || name == folderName {
+				tableToFolder[table.Name] = name
+			}
+		}
+	}
+
+	for _, relation := range folder.Relations.Relations {
+		report.Relations++
+		for i, childKey := range relation.Child.Keys {
+			if i >= len(relation.Parent.Keys) {
+				break
+			}
+			parent := lookupMaskedColumn(projectData, tableToFolder, relation.Parent.Name, relation.Parent.Keys[i])
+			child := lookupMaskedColumn(projectData, tableToFolder, relation.Child.Name, childKey)
+			problem, message := compareKeyMasks(parent, child)
+			if problem == "" {
+				continue
+			}
+			report.Issues = append(report.Issues, ConsistencyIssue{
+				Relation:   relation.Name,
+				Parent:     parent.name,
+				Child:      child.name,
+				ParentMask: parent.kinds(),
+				ChildMask:  child.kinds(),
+				Problem:    problem,
+				Message:    message,
+			})
+		}
+	}
+	return report
+}
+
+// compareKeyMasks tells whether a foreign key is guaranteed to be masked like the key it references,
+// and returns the problem and its explanation when it is not.
+func compareKeyMasks(parent, child maskedColumn) (string, string) {
+	switch {
+	case len(parent.masks) == 0 && len(child.masks) == 0:
+		return "", ""
+	case len(parent.masks) == 0:
+		return CONSISTENCY_UNMASKED_PARENT, fmt.Sprintf("%s is masked but %s, which it references, is not", child.name, parent.name)
+	case len(child.masks) == 0:
+		return CONSISTENCY_UNMASKED_CHILD, fmt.Sprintf("%s is masked but %s, which references it, is not", parent.name, child.name)
+	}
+
+	// A shared cache gives the foreign key the values given to the key.
+	if parent.rule.Cache != "" && parent.rule.Cache == child.rule.Cache {
+		return "", ""
+	}
+	if fromCache, ok := child.masks[len(child.masks)-1]["fromCache"]; ok && parent.rule.Cache != "" && fromCache == parent.rule.Cache {
+		return "", ""
+	}
+
+	if parent.kinds() != child.kinds() {
+		return CONSISTENCY_DIFFERENT_MASKS, fmt.Sprintf("%s is masked with %s but %s with %s", parent.name, parent.kinds(), child.name, child.kinds())
+	}
+	if !reflect.DeepEqual(parent.masks, child.masks) {
+		return CONSISTENCY_DIFFERENT_PARAMETERS, fmt.Sprintf("%s and %s use %s with different parameters", parent.name, child.name, parent.kinds())
+	}
+
+	deterministic, seeded := true, false
+	for _, mask := range parent.masks {
+		for kind, args := range mask {
+			switch {
+			case slices.Contains(keyedMasks, kind):
+			case slices.Contains(seededMasks, kind) || hasSeeder(args):
+				seeded = true
+			default:
+				deterministic = false
+			}
+		}
+	}
+	switch {
+	case !deterministic:
+		return CONSISTENCY_NO_SHARED_CACHE, fmt.Sprintf("%s gives random values: %s and %s must share a cache", parent.kinds(), parent.name, child.name)
+	case seeded && parent.seed != child.seed:
+		return CONSISTENCY_DIFFERENT_SEED, fmt.Sprintf("the masking files of %s and %s have different seeds (%d and %d)", parent.name, child.name, parent.seed, child.seed)
+	}
+	return "", ""
+}
+
+// hasSeeder tells whether the parameters of a mask derive its randomness from a field value.
+func hasSeeder(args interface{}) bool {
+	params, ok := args.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = params["seeder"]
+	return ok
+}
+
+// consistencyHandler serves the consistency report of the relations of a folder.
+func consistencyHandler(store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		snap := store.Snapshot()
+		if _, ok := snap.Data[folderName]; !ok {
+			http.Error(w, fmt.Sprintf("folder '%s' not found", folderName), http.StatusNotFound)
+			return
+		}
+		if checkNotModified(w, r, snap) {
+			return
+		}
+
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(checkConsistency(snap.Data, folderName)); err != nil {
+			log.Printf("Failed to encode consistency report to JSON: %v", err)
+		}
+	}
+}
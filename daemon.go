@@ -2,16 +2,18 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -29,40 +31,88 @@ const (
 )
 
 // startDaemon initializes and starts the web server.
-func startDaemon(projectData ProjectData, fileMap map[string]string, inputPaths []string, port string, publicFS fs.FS) {
+func startDaemon(fileMap map[string]string, inputPaths []string, port string, publicFS fs.FS) {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5)) // Add gzip compression middleware
 
+	// Every external tool runs through the executor, with its own working directory.
+	executor := newExecutor("")
+	// Every file operation goes through the workspace, which keeps it inside the input paths.
+	ws, err := newWorkspace(inputPaths)
+	if err != nil {
+		log.Fatalf("Failed to open workspace: %v", err)
+	}
+	// Every handler reads the project through the store, which swaps snapshots atomically.
+	store := newProjectStore(inputPaths, fileMap)
+	store.hub = newEventHub()
+	// Git operations only ever target the local repositories of the input paths.
+	git := newGitWorkspace(ws, executor)
+	if watchInterval > 0 {
+		watcher := newProjectWatcher(store, watchInterval)
+		watcher.ws = ws
+		go watcher.run()
+	}
+
 	// API routes
-	r.Get("/api/schema.{format:(dot|svg|png)}", serveSchema(&projectData))
-	r.Get("/api/schema/{folder}.{format:(dot|svg|png)}", serveSchema(&projectData))
-	r.Get("/api/plot/{folder}/{tableName}", servePlot(projectData))
-	r.Get("/api/playbook/{folder}", servePlaybook(&projectData))
-	r.Get("/api/new/mask/{folderName}/{tableName}", createMaskFile(&projectData, inputPaths, fileMap))
+	r.Get("/api/schema.{format:(dot|svg|png)}", serveSchema(store, executor))
+	r.Get("/api/schema/{folder}.{format:(dot|svg|png)}", serveSchema(store, executor))
+	r.Get("/api/plot/{folder}/{tableName}", servePlot(store))
+	r.Get("/api/playbook/{folder}", servePlaybook(store))
+	r.Get("/api/new/mask/{folderName}/{tableName}", createMaskFile(store, ws))
+	r.Get("/api/suggest/mask/{folder}/{table}", suggestMaskHandler(store, ws))
+	r.Post("/api/suggest/mask/{folder}/{table}", suggestMaskHandler(store, ws))
+	r.Get("/api/masking/{folder}", maskingModelHandler(store))
+	r.Get("/api/masking/{folder}/{table}", maskingModelHandler(store))
+	r.Get("/api/masking/{folder}/{table}/{column}", maskingColumnHandler(store, ws))
+	r.Get("/api/consistency/{folder}", consistencyHandler(store))
+	r.Get("/api/sample/{folder}/{table}", sampleRowsHandler(store))
+	r.Post("/api/analyze/{folder}", analyzeHandler(store, ws))
+	r.Post("/api/import/ddl/{folder}", importDDLHandler(store, ws))
+	r.Get("/api/relations/suggest/{folder}", suggestRelationsHandler(store, ws))
+	r.Post("/api/relations/suggest/{folder}", suggestRelationsHandler(store, ws))
+	r.Get("/api/order/{folder}", loadOrderHandler(store))
+	r.Put("/api/masking/{folder}/{table}/{column}", maskingColumnHandler(store, ws))
+	r.Delete("/api/masking/{folder}/{table}/{column}", maskingColumnHandler(store, ws))
 
 	// New API routes for folder and file creation
-	r.Get("/api/folder/*", createFolderHandler())
+	r.Get("/api/folder/*", createFolderHandler(ws))
 	// r.Post("/api/new/mask/*", createFileHandler("mask", &projectData, inputPaths))
-	r.Get("/api/new/playbook/*", createFileHandler("playbook", &projectData, inputPaths))
-	r.Get("/api/new/dataconnectors/*", createFileHandler("dataconnectors", &projectData, inputPaths))
-	r.Get("/api/new/bash/*", createFileHandler("bash", &projectData, inputPaths))
+	r.Get("/api/new/playbook/*", createFileHandler("playbook", store, ws))
+	r.Get("/api/new/dataconnectors/*", createFileHandler("dataconnectors", store, ws))
+	r.Get("/api/new/bash/*", createFileHandler("bash", store, ws))
 
 	// API routes for file handling
-	r.Get("/api/files", listFilesHandler(inputPaths))
-	r.Get("/api/file/*", getFileHandler(inputPaths))
-	r.Post("/api/file/*", updateFileHandler(inputPaths, &projectData))
+	r.Get("/api/files", listFilesHandler(ws, store, git))
+	r.Get("/api/file/*", getFileHandler(ws))
+	r.Post("/api/file/*", updateFileHandler(ws, store))
+	r.Delete("/api/file/*", deleteFileHandler(ws, store, git))
+	r.Post("/api/move", moveFileHandler(ws, store, git, false))
+	r.Post("/api/copy", moveFileHandler(ws, store, git, true))
+	r.Get("/api/file-history/*", fileHistoryHandler(ws))
+	r.Post("/api/file-history/*", restoreFileHandler(ws, store))
+
+	// API routes for the local git repositories
+	r.Get("/api/git/status", gitStatusHandler(git))
+	r.Get("/api/git/diff/*", gitDiffHandler(git))
+	r.Post("/api/git/stage", gitStageHandler(git))
+	r.Post("/api/git/commit", gitCommitHandler(git))
 
 	// API routes that executes Command lines actions
-	r.Post("/api/exec/pimo", pimoExecHandler())
-	r.Post("/api/exec/playbook/{folder}/{filename}", execCommandHandler())
-	r.Get("/api/exec/lino/fetch/{folder}/{filename}", fetchLinoExampleHandler(inputPaths, fileMap))
-	r.Post("/api/exec/pull/{folder}/{filename}", execCommandHandler())
+	r.Post("/api/exec/pimo", pimoExecHandler(executor))
+	r.Post("/api/exec/pimo/preview", pimoPreviewHandler(executor))
+	r.Post("/api/exec/pimo/check", pimoCheckHandler(executor))
+	r.Get("/api/check/masking/{folder}/{table}", maskingCheckHandler(store, ws, executor))
+	r.Post("/api/exec/playbook/{folder}/{filename}", execCommandHandler(executor))
+	r.Get("/api/exec/lino/fetch/{folder}/{filename}", fetchLinoExampleHandler(ws, executor))
+	r.Post("/api/exec/pull/{folder}/{filename}", execCommandHandler(executor))
 
 	// New API route for reloading schemas
-	r.Post("/api/reload", reloadHandler(&projectData, inputPaths))
+	r.Post("/api/reload", reloadHandler(store))
+	// Server-Sent Events stream notifying browsers of every new project revision
+	r.Get("/api/events", eventsHandler(store.hub, store))
 
 	log.Printf("Starting web server on http://localhost:%s", port)
 
@@ -87,81 +137,73 @@ func customFileServer(fs fs.FS) http.Handler {
 }
 
 // createMaskFile handles the creation of a boilerplate masking file.
-func createMaskFile(projectData *ProjectData, inputPaths []string, fileMap map[string]string) http.HandlerFunc {
+func createMaskFile(store *ProjectStore, ws *Workspace) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		folderName := chi.URLParam(r, "folderName")
 		tableName := chi.URLParam(r, "tableName")
-		currentProjectData := *projectData
+		snap := store.Snapshot()
+		if r.URL.Query().Get("sync") == "true" {
+			// Syncing compares with the tables as they are on disk now, whatever the watcher saw.
+			if reloaded, err := store.Reload(); err != nil {
+				log.Printf("Creating mask.yaml for '%s'.'%s': reload failed: %v", folderName, tableName, err)
+			} else {
+				snap = reloaded
+			}
+		}
 		// Find the table to get its columns
-		tableFolder, table, err := findTableLocation(currentProjectData, tableName, folderName)
+		tableFolder, table, err := findTableLocation(snap.Data, tableName, folderName)
 		if err != nil {
 			log.Printf("Creating mask.yaml for '%s'.'%s': %v", folderName, tableName, err)
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
 
-		// Find the base path for the folder to construct the file path.
-		// This logic finds the base path from the original input paths.
-		basePath, ok := findBasePathForFolder(inputPaths, tableFolder, fileMap)
-		if !ok {
-			http.Error(w, fmt.Sprintf("Could not determine file path for folder '%s'", tableFolder), http.StatusInternalServerError)
+		filePath, err := maskingFilePath(ws, tableFolder, tableName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
 			return
 		}
-		if info, err := os.Stat(basePath); err == nil && info.IsDir() {
-			basePath = filepath.Join(basePath, tableFolder)
-		}
+		overwrite := r.URL.Query().Get("overwrite") == "true"
 
-		filePath := filepath.Join(basePath, fmt.Sprintf("%s"+SUFFIX_MASKING, tableName))
-
-		var sb strings.Builder
-		sb.WriteString("version: \"1\"\n")
-		sb.WriteString("seed: 42\n")
-		sb.WriteString("masking:\n")
-		for _, col := range table.Columns {
-			sb.WriteString(fmt.Sprintf("  - selector:\n      jsonpath: \"%s\"\n    mask:\n      # regex: \"\"\n", col.Name))
+		if r.URL.Query().Get("sync") == "true" {
+			syncMaskFile(w, store, ws, filePath, *table)
+			return
 		}
 
-		if err := os.WriteFile(filePath, []byte(sb.String()), 0644); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create masking file: %v", err), http.StatusInternalServerError)
+		// An existing masking file is only replaced on demand, its content is kept in the file history.
+		if err := ws.WriteFileAt(filePath, newMaskingFile(*table), overwrite); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				err = fmt.Errorf("%w, add ?overwrite=true to replace it", err)
+			}
+			http.Error(w, fmt.Sprintf("Failed to create masking file: %v", err), workspaceErrorStatus(err))
 			return
 		}
 
 		// Reload schemas
-		reloadSchemas(projectData, inputPaths)
+		reloadSchemas(store)
 		w.WriteHeader(http.StatusCreated)
 		fmt.Fprintf(w, "File %s created successfully", filePath)
 	}
 }
 
-func findBasePathForFolder(inputPaths []string, folderName string, fileMap map[string]string) (string, bool) {
-	// This function needs to find the correct base directory where the folder `folderName` lives.
-	// The logic in `inferAllSchemas` determines the `folderName` (relPath). We need to reverse that to find the correct output path.
-	for _, path := range inputPaths {
-		info, err := os.Stat(path)
-		if err != nil {
-			continue // Ignore invalid paths
-		}
-		if info.IsDir() {
-			// If an input path is a directory, check if `folderName` is a direct subdirectory.
-			if filepath.Base(path) == folderName {
-				return filepath.Dir(path), true
-			}
-			// Check for subdirectories inside this input path
-			if _, err := os.Stat(filepath.Join(path, folderName)); err == nil {
-				return path, true
-			}
-		} else if filepath.Base(filepath.Dir(path)) == folderName {
-			return filepath.Dir(path), true
-		}
+// maskingFilePath returns the absolute path of the masking file of a table, next to the files of its folder.
+func maskingFilePath(ws *Workspace, folderName, tableName string) (string, error) {
+	folderDir, err := ws.FolderDir(folderName)
+	if err != nil {
+		return "", fmt.Errorf("could not determine file path for folder '%s': %w", folderName, err)
 	}
-	return "", false
+	return filepath.Join(folderDir, tableName+SUFFIX_MASKING), nil
 }
 
 // serveSchema generates and returns the DOT graph schema.
-func serveSchema(projectData *ProjectData) http.HandlerFunc {
+func serveSchema(store *ProjectStore, executor *Executor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		format := chi.URLParam(r, "format")
 		folderName := chi.URLParam(r, "folder")
+		snap := store.Snapshot()
+		if checkNotModified(w, r, snap) {
+			return
+		}
 
 		var dotString string
 		// Add a recover block to catch panics from generateCombinedDotGraph
@@ -172,10 +214,17 @@ func serveSchema(projectData *ProjectData) http.HandlerFunc {
 			}
 		}()
 
+		// ?expand=table.column shows the masks of the JSON sub-fields of a column, repeated or comma separated.
+		expanded := make(map[string]bool)
+		for _, values := range r.URL.Query()["expand"] {
+			for _, value := range strings.Split(values, ",") {
+				expanded[value] = true
+			}
+		}
 		if folderName != "" {
-			dotString = generateCombinedDotGraph(*projectData, folderName)
+			dotString = generateCombinedDotGraph(snap.Data, expanded, folderName)
 		} else {
-			dotString = generateCombinedDotGraph(*projectData)
+			dotString = generateCombinedDotGraph(snap.Data, expanded)
 		}
 
 		if dotString == "" {
@@ -194,11 +243,9 @@ func serveSchema(projectData *ProjectData) http.HandlerFunc {
 			// return // Explicitly return here
 
 		case "svg", "png":
-			cmd := exec.Command("dot", "-T"+format)
-			cmd.Stderr = io.Discard // Silence warnings by redirecting stderr
-			cmd.Stdin = strings.NewReader(dotString)
-
-			output, err := cmd.Output() // Use Output() to get only stdout
+			// Only stdout is kept, dot warnings on stderr are silenced.
+			res, err := executor.Run(r.Context(), Command{Name: "dot", Args: []string{"-T" + format}, Stdin: strings.NewReader(dotString)})
+			output := res.Stdout
 			if err != nil {
 				// If there's an error but we still got some output, log it as a warning and proceed.
 				log.Printf("Warning: dot command for format %s exited with an error but still produced output. Error: %v", format, err)
@@ -223,8 +270,46 @@ func serveSchema(projectData *ProjectData) http.HandlerFunc {
 	}
 }
 
+// syncMaskFile updates an existing masking file with the columns of its table, see syncMaskingFile,
+// or creates it when missing, and answers with the sync report.
+func syncMaskFile(w http.ResponseWriter, store *ProjectStore, ws *Workspace, filePath string, table Table) {
+	var report MaskSyncReport
+	invalid := false
+	err := ws.UpdateFileAt(filePath, func(content []byte, exists bool) ([]byte, error) {
+		if !exists {
+			report = MaskSyncReport{Created: true, Added: []string{}, Removed: []string{}, Restored: []string{}}
+			for _, col := range table.Columns {
+				report.Added = append(report.Added, col.Name)
+			}
+			return newMaskingFile(table), nil
+		}
+		updated, syncReport, err := syncMaskingFile(content, table)
+		report, invalid = syncReport, err != nil
+		return updated, err
+	})
+	if err != nil {
+		status := workspaceErrorStatus(err)
+		if invalid {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, fmt.Sprintf("Failed to sync masking file: %v", err), status)
+		return
+	}
+	report.File, _ = ws.RelPath(filePath)
+	log.Printf("Synced %s: %d added, %d removed, %d restored columns", filePath, len(report.Added), len(report.Removed), len(report.Restored))
+
+	reloadSchemas(store)
+	w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+	if report.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode sync report to JSON: %v", err)
+	}
+}
+
 // createFolderHandler creates a new folder recursively.
-func createFolderHandler() http.HandlerFunc {
+func createFolderHandler(ws *Workspace) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		folderName := chi.URLParam(r, "*")
 		if folderName == "" {
@@ -232,20 +317,11 @@ func createFolderHandler() http.HandlerFunc {
 			return
 		}
 
-		// Sanitize folderName to prevent directory traversal
-		cleanFolderName := filepath.Clean(folderName)
-		if strings.HasPrefix(cleanFolderName, "..") || filepath.IsAbs(cleanFolderName) {
-			http.Error(w, "Invalid folder name: cannot use absolute or parent paths", http.StatusBadRequest)
-			return
-		}
-
-		// For simplicity, new folders are created relative to the current working directory
-		fullPath := cleanFolderName
-
-		err := os.MkdirAll(fullPath, 0755) // 0755 gives read/write/execute for owner, read/execute for group/others
+		// The workspace rejects absolute, parent and symlinked paths leading outside of it.
+		fullPath, err := ws.MkdirAll(folderName)
 		if err != nil {
-			log.Printf("Error creating folder '%s': %v", fullPath, err)
-			http.Error(w, fmt.Sprintf("Failed to create folder: %v", err), http.StatusInternalServerError)
+			log.Printf("Error creating folder '%s': %v", folderName, err)
+			http.Error(w, fmt.Sprintf("Failed to create folder: %v", err), workspaceErrorStatus(err))
 			return
 		}
 
@@ -255,15 +331,9 @@ func createFolderHandler() http.HandlerFunc {
 }
 
 // createFileHandler creates a new file with boilerplate content based on type.
-func createFileHandler(fileType string, projectData *ProjectData, inputPaths []string) http.HandlerFunc {
+func createFileHandler(fileType string, store *ProjectStore, ws *Workspace) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := chi.URLParam(r, "*")
-		// filename := chi.URLParam(r, "filename")
-
-		// if folderName == "" {
-		// 	http.Error(w, "Folder name is required", http.StatusBadRequest)
-		// 	return
-		// }
 
 		content, ok := templates[fileType]
 		if !ok {
@@ -285,56 +355,48 @@ func createFileHandler(fileType string, projectData *ProjectData, inputPaths []s
 				path += SUFFIX_SH
 			}
 		}
-		// For simplicity, new files are created relative to the current working directory
-		// or within the first input path if available.
-		basePath := "." // Default to current directory
-		if len(inputPaths) > 0 {
-			basePath = inputPaths[0]
-			info, err := os.Stat(basePath)
-			if err == nil && !info.IsDir() {
-				basePath = filepath.Dir(basePath) // If inputPath is a file, use its directory
-			}
-		}
 
-		// fullPath := filepath.Join(basePath, folderName, finalFilename)
-
-		// Ensure the directory exists
-		dir := filepath.Dir(path)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("Error creating directory '%s': %v", dir, err)
-			http.Error(w, fmt.Sprintf("Failed to create directory: %v", err), http.StatusInternalServerError)
-			return
-		}
-
-		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		// New files are created inside the workspace, their folders included.
+		fullPath, err := ws.WriteFile(path, []byte(content))
+		if err != nil {
 			log.Printf("Error creating file '%s': %v", path, err)
-			http.Error(w, fmt.Sprintf("Failed to create file: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to create file: %v", err), workspaceErrorStatus(err))
 			return
 		}
 
 		// Reload schemas after file creation
-		reloadSchemas(projectData, inputPaths)
+		reloadSchemas(store)
 
 		w.WriteHeader(http.StatusCreated)
-		fmt.Fprintf(w, "File '%s' created successfully", path)
+		fmt.Fprintf(w, "File '%s' created successfully", fullPath)
 	}
 }
 
 // reloadHandler resets and re-parses all YAML files.
-func reloadHandler(projectData *ProjectData, inputPaths []string) http.HandlerFunc {
+func reloadHandler(store *ProjectStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		reloadSchemas(projectData, inputPaths)
+		snap, err := store.Reload()
+		if err != nil {
+			log.Printf("Error reloading schemas: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to reload schemas: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", snap.ETag())
 		w.WriteHeader(http.StatusOK)
-		fmt.Fprint(w, "Schemas reloaded successfully")
+		fmt.Fprintf(w, "Schemas reloaded successfully (revision %d)", snap.Revision)
 	}
 }
 
 // servePlaybook generates and returns the DOT graph for a playbook.
-func servePlaybook(projectData *ProjectData) http.HandlerFunc {
+func servePlaybook(store *ProjectStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		folderName := chi.URLParam(r, "folder")
-		if folderData, ok := (*projectData)[folderName]; ok {
+		snap := store.Snapshot()
+		if folderData, ok := snap.Data[folderName]; ok {
 			if folderData.Playbook != nil {
+				if checkNotModified(w, r, snap) {
+					return
+				}
 				dotString := generateAnsiblePlaybookGraph(folderData.Playbook)
 				w.Write([]byte(dotString))
 				return
@@ -345,7 +407,7 @@ func servePlaybook(projectData *ProjectData) http.HandlerFunc {
 }
 
 // servePlot generates and returns a plot image for a given table.
-func servePlot(projectData ProjectData) http.HandlerFunc {
+func servePlot(store *ProjectStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		folderName := chi.URLParam(r, "folder")
 		tableName := chi.URLParam(r, "tableName")
@@ -353,8 +415,12 @@ func servePlot(projectData ProjectData) http.HandlerFunc {
 			http.Error(w, "Table name is required", http.StatusBadRequest)
 			return
 		}
+		snap := store.Snapshot()
+		if checkNotModified(w, r, snap) {
+			return
+		}
 
-		imgBytes, err := generatePlotForTableToMemory(projectData, tableName, folderName)
+		imgBytes, err := generatePlotForTableToMemory(snap.Data, tableName, folderName)
 		if err != nil {
 			log.Printf("Error generating plot for table %s: %v", tableName, err)
 			// Return a placeholder DOT graph instead of an image
@@ -380,247 +446,229 @@ func servePlot(projectData ProjectData) http.HandlerFunc {
 	}
 }
 
-// reloadSchemas finds all YAML files and re-infers the project data structure.
-func reloadSchemas(projectData *ProjectData, inputPaths []string) {
-	newFileMap, err := findYAMLFiles(inputPaths)
-	if err != nil {
-		log.Printf("Error finding YAML files during reload: %v", err)
-		return
+// reloadSchemas re-parses the project after a write, logging failures instead of failing the request.
+func reloadSchemas(store *ProjectStore) {
+	if _, err := store.Reload(); err != nil {
+		log.Printf("Error reloading schemas: %v", err)
 	}
-	newSchemas, err := inferAllSchemas(newFileMap)
-	if err != nil {
-		log.Printf("Error inferring schemas during reload: %v", err)
-		return
-	}
-	// Atomically update the project data
-	*projectData = newSchemas
-	log.Println("Successfully reloaded schemas.")
 }
 
-// buildFileTree recursively builds a tree of files and folders for a given path.
-// It skips hidden files/folders and the "public" directory.
-func buildFileTree(path string) ([]interface{}, error) {
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return nil, err
-	}
-
-	content := make([]interface{}, 0, len(entries))
-	for _, entry := range entries {
-		name := entry.Name()
-		// Skip hidden files and folders, and the 'public' folder
-		if strings.HasPrefix(name, ".") || name == "public" {
-			continue
-		}
-
-		entryPath := filepath.Join(path, name)
-
-		if entry.IsDir() {
-			subfolderContent, err := buildFileTree(entryPath)
-			if err != nil {
-				return nil, err
-			}
-			if len(subfolderContent) > 0 {
-				content = append(content, map[string][]interface{}{name: subfolderContent})
-			}
-		} else if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
-			content = append(content, name)
-		}
+// listFilesHandler serves the workspace file tree as JSON.
+func listFilesHandler(ws *Workspace, store *ProjectStore, git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeFileTree(w, r, ws, store, git, http.StatusOK)
 	}
-
-	return content, nil
 }
 
-// listFilesHandler serves a JSON structure of all discovered YAML files.
-func listFilesHandler(inputPaths []string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// The top-level structure should be a map with "Workspace" as the key,
-		// and its value an array of items (files or folders).
-		workspaceItems := make([]interface{}, 0)
-
-		for _, basePath := range inputPaths {
-			// Normalize basePath to ensure consistent path separators
-			basePath = filepath.Clean(basePath)
-
-			info, err := os.Stat(basePath)
-			if err != nil {
-				log.Printf("Error stating path %s: %v", basePath, err)
-				continue
-			}
-
-			if info.IsDir() {
-				// If basePath is a directory, its name becomes a top-level folder under "Workspace"
-				folderContent, err := buildFileTree(basePath)
-				if err != nil {
-					http.Error(w, fmt.Sprintf("Failed to build file tree for %s: %v", basePath, err), http.StatusInternalServerError)
-					return
-				}
-				if len(folderContent) > 0 {
-					folderName := filepath.Base(basePath)
-					if folderName == "." {
-						// If the folder is '.', flatten its content into the workspace
-						workspaceItems = append(workspaceItems, folderContent...)
-					} else {
-						workspaceItems = append(workspaceItems, map[string][]interface{}{folderName: folderContent})
-					}
-				}
-			} else {
-				// If basePath is a file, add it directly to "Workspace"
-				fileName := filepath.Base(basePath)
-				if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
-					workspaceItems = append(workspaceItems, fileName)
-				}
-			}
-		}
-
-		fileTree := map[string]interface{}{
-			"Workspace": workspaceItems,
+// writeFileTree encodes the workspace file tree as JSON with the given status code,
+// annotated with the parse results of the current snapshot and the git status.
+func writeFileTree(w http.ResponseWriter, r *http.Request, ws *Workspace, store *ProjectStore, git *GitWorkspace, status int) {
+	gitStatus := make(map[string]string)
+	if files, err := git.Status(r.Context()); err == nil {
+		for path, fileStatus := range files.Files {
+			gitStatus[path] = fileStatus.Status
 		}
+	} else {
+		log.Printf("Failed to get git status: %v", err)
+	}
+	nodes, err := buildWorkspaceTree(ws, store.Snapshot(), gitStatus)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build file tree: %v", err), http.StatusInternalServerError)
+		return
+	}
 
-		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
-		if err := json.NewEncoder(w).Encode(fileTree); err != nil {
-			http.Error(w, "Failed to encode file list to JSON", http.StatusInternalServerError)
-		}
+	// The top-level structure is a map with "Workspace" as the key, and the top-level nodes as value.
+	w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string][]*FileNode{"Workspace": nodes}); err != nil {
+		log.Printf("Failed to encode file list to JSON: %v", err)
 	}
 }
 
 // getFileHandler serves the content of a specific file.
-func getFileHandler(inputPaths []string) http.HandlerFunc {
+func getFileHandler(ws *Workspace) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filepathParam := strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+		filepathParam := chi.URLParam(r, "*")
 		log.Printf("getFileHandler: Received request for filepath: %s", filepathParam)
 
-		fullPath, err := findSecureFilePath(inputPaths, filepathParam)
+		fullPath, err := ws.ResolveExisting(filepathParam)
 		if err != nil {
-			log.Printf("getFileHandler: Error finding secure file path for %s: %v", filepathParam, err)
-			http.Error(w, err.Error(), http.StatusNotFound)
+			log.Printf("getFileHandler: Error resolving workspace path %s: %v", filepathParam, err)
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read file: %v", err), http.StatusInternalServerError)
 			return
 		}
 		log.Printf("getFileHandler: Serving file from full path: %s", fullPath)
-		http.ServeFile(w, r, fullPath)
+
+		// The ETag must be sent back in If-Match when saving the file.
+		var modTime time.Time
+		if info, err := os.Stat(fullPath); err == nil {
+			modTime = info.ModTime()
+		}
+		w.Header().Set("ETag", contentETag(content))
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, filepath.Base(fullPath), modTime, bytes.NewReader(content))
 	}
 }
 
 // updateFileHandler replaces a file with the content from the POST body.
-func updateFileHandler(inputPaths []string, projectData *ProjectData) http.HandlerFunc {
+func updateFileHandler(ws *Workspace, store *ProjectStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filepathParam := strings.TrimPrefix(chi.URLParam(r, "*"), "/")
+		filepathParam := chi.URLParam(r, "*")
 		log.Printf("updateFileHandler: Received request to update filepath: %s", filepathParam)
 
-		fullPath, err := findSecureFilePath(inputPaths, filepathParam)
-		if err != nil {
-			log.Printf("updateFileHandler: Error finding secure file path for %s: %v", filepathParam, err)
-			http.Error(w, err.Error(), http.StatusNotFound)
+		// Saving requires the ETag read with the file, so that concurrent edits are never lost silently.
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			http.Error(w, "If-Match header is required: send the ETag returned by GET /api/file, or * to overwrite", http.StatusPreconditionRequired)
 			return
 		}
 
-		filePath := fullPath
-
 		body, err := io.ReadAll(r.Body)
-		log.Printf("updateFileHandler: Attempting to write to file: %s", filePath)
 		if err != nil {
 			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
 			return
 		}
 		defer r.Body.Close()
 
-		if err := os.WriteFile(filePath, body, 0644); err != nil {
-			http.Error(w, "Failed to write file", http.StatusInternalServerError)
+		filePath, current, err := ws.WriteFileIfMatch(filepathParam, body, ifMatch)
+		if errors.Is(err, errModified) {
+			// Send back the current content, so that the client can merge or overwrite.
+			log.Printf("updateFileHandler: %s was modified since it was read", filePath)
+			w.Header().Set("ETag", contentETag(current))
+			w.Header().Set(CONTENT_TYPE, "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write(current)
+			return
+		}
+		if err != nil {
+			log.Printf("updateFileHandler: Error writing %s: %v", filepathParam, err)
+			http.Error(w, fmt.Sprintf("Failed to write file: %v", err), workspaceErrorStatus(err))
 			return
 		}
+		log.Printf("updateFileHandler: Wrote file: %s", filePath)
 
 		// After updating the file, reload all schemas
-		reloadSchemas(projectData, inputPaths)
+		reloadSchemas(store)
 
+		w.Header().Set("ETag", contentETag(body))
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, "File %s updated successfully", filepathParam)
 	}
 }
 
-// findSecureFilePath locates the absolute path for a file within the allowed input directories.
-func findSecureFilePath(inputPaths []string, relativeFilePath string) (string, error) {
-	for _, basePath := range inputPaths {
-		// Attempt 1: Join the basePath and the relative path.
-		// This works for paths like `nino -d .` and URL `/api/file/petstore/source/analyze.yaml`
-		candidatePath1 := filepath.Join(basePath, relativeFilePath)
-		if _, err := os.Stat(candidatePath1); err == nil {
-			cleanPath, err := filepath.Abs(candidatePath1)
-			if err != nil {
-				return "", err
-			}
-			log.Printf("findSecureFilePath: File found at %s", cleanPath)
-			return cleanPath, nil
-		}
+// deleteFileHandler deletes a workspace file and returns the updated file tree.
+// Folders must be empty unless the "recursive" query parameter is true.
+func deleteFileHandler(ws *Workspace, store *ProjectStore, git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filepathParam := chi.URLParam(r, "*")
+		recursive := r.URL.Query().Get("recursive") == "true"
 
-		// Attempt 2: Check if the relative path is complete from the parent of the basePath.
-		// This works for paths like `nino -d ./petstore` and URL `/api/file/petstore/source/analyze.yaml`
-		// where `basePath` is `./petstore` and `relativeFilePath` is `petstore/source/analyze.yaml`.
-		parentOfBasePath := filepath.Dir(basePath)
-		candidatePath2 := filepath.Join(parentOfBasePath, relativeFilePath)
-		if _, err := os.Stat(candidatePath2); err == nil {
-			cleanPath, err := filepath.Abs(candidatePath2)
-			if err != nil {
-				return "", err
-			}
-			log.Printf("findSecureFilePath: File found at %s", cleanPath)
-			return cleanPath, nil
+		fullPath, err := ws.Remove(filepathParam, recursive)
+		if err != nil {
+			log.Printf("deleteFileHandler: Error deleting %s: %v", filepathParam, err)
+			http.Error(w, fmt.Sprintf("Failed to delete '%s': %v", filepathParam, err), workspaceErrorStatus(err))
+			return
 		}
-	}
+		log.Printf("deleteFileHandler: Deleted %s", fullPath)
 
-	return "", fmt.Errorf("file '%s' not found in any configured input path", relativeFilePath)
+		reloadSchemas(store)
+		writeFileTree(w, r, ws, store, git, http.StatusOK)
+	}
 }
 
-// PimoExecRequest defines the structure for the /pimo/exec request body.
-type PimoExecRequest struct {
-	YAML string `json:"yaml"`
-	JSON string `json:"json"`
+// FileMoveRequest defines the structure for the /api/move and /api/copy request bodies.
+type FileMoveRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
 }
 
-// pimoExecHandler handles the execution of the pimo CLI tool.
-func pimoExecHandler() http.HandlerFunc {
+// moveFileHandler renames, moves or copies a workspace file or folder and returns the updated file tree.
+func moveFileHandler(ws *Workspace, store *ProjectStore, git *GitWorkspace, copy bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var req PimoExecRequest
+		var req FileMoveRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 			return
 		}
+		if req.From == "" || req.To == "" {
+			http.Error(w, "Both 'from' and 'to' are required", http.StatusBadRequest)
+			return
+		}
 
-		// Define temporary file paths
-		maskFile, err := os.CreateTemp(".", "mask-*.yaml")
+		operation, move := "move", ws.Rename
+		if copy {
+			operation, move = "copy", ws.Copy
+		}
+		fullPath, err := move(req.From, req.To)
 		if err != nil {
-			http.Error(w, "Failed to create temporary mask file", http.StatusInternalServerError)
+			log.Printf("moveFileHandler: Error during %s of %s to %s: %v", operation, req.From, req.To, err)
+			http.Error(w, fmt.Sprintf("Failed to %s '%s' to '%s': %v", operation, req.From, req.To, err), workspaceErrorStatus(err))
 			return
 		}
-		defer os.Remove(maskFile.Name()) // Clean up the file afterwards
+		log.Printf("moveFileHandler: %s of %s to %s done", operation, req.From, fullPath)
+
+		reloadSchemas(store)
+		writeFileTree(w, r, ws, store, git, http.StatusOK)
+	}
+}
+
+// PimoExecRequest defines the structure for the /pimo/exec request body.
+type PimoExecRequest struct {
+	YAML string `json:"yaml"`
+	JSON string `json:"json"`
+}
+
+// runPimo masks the JSON lines of a request with its masking file.
+func runPimo(ctx context.Context, executor *Executor, req PimoExecRequest, args ...string) (CommandResult, error) {
+	// Each request gets its own scratch directory, so parallel runs never share files.
+	workDir, err := os.MkdirTemp("", "nino-pimo-*")
+	if err != nil {
+		return CommandResult{}, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(workDir) // Clean up the directory afterwards
+
+	// Write the YAML content to a temporary masking file
+	maskFile := filepath.Join(workDir, "masking.yaml")
+	if err := os.WriteFile(maskFile, []byte(req.YAML), 0644); err != nil {
+		return CommandResult{}, fmt.Errorf("failed to write mask file: %w", err)
+	}
 
-		// Write the YAML and JSON content to temporary files
-		if _, err := maskFile.Write([]byte(req.YAML)); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to write mask file: %v", err), http.StatusInternalServerError)
+	return executor.Run(ctx, Command{
+		Name:  "pimo",
+		Args:  append([]string{"-c", maskFile}, args...),
+		Dir:   workDir,
+		Stdin: strings.NewReader(req.JSON),
+	})
+}
+
+// pimoExecHandler handles the execution of the pimo CLI tool.
+func pimoExecHandler(executor *Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PimoExecRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
 			return
 		}
-		maskFile.Close()
 
-		// Prepare the command
-		cmd := exec.Command("pimo", "-c", maskFile.Name())
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-		cmd.Stdin = strings.NewReader(req.JSON)
-
-		// Execute the command
-		output, err := cmd.Output()
+		res, err := runPimo(r.Context(), executor, req)
 		if err != nil {
-			log.Printf("Error executing pimo command %s: %v\n%s", cmd, err, stderr.String())
-			http.Error(w, fmt.Sprintf("Failed to execute pimo command: %v\n%s", err, stderr.String()), http.StatusInternalServerError)
+			log.Printf("Error executing pimo command: %v\n%s", err, res.Stderr)
+			http.Error(w, fmt.Sprintf("Failed to execute pimo command: %v\n%s", err, res.Stderr), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set(CONTENT_TYPE, "application/json")
-		w.Write(output)
+		w.Write(res.Stdout)
 	}
 }
 
 // execCommandHandler creates a handler that executes a given command and returns its output.
-func execCommandHandler() http.HandlerFunc {
+func execCommandHandler(executor *Executor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -635,10 +683,13 @@ func execCommandHandler() http.HandlerFunc {
 			return
 		}
 
-		log.Printf("Executing command: %s", script)
-
-		cmd := exec.Command("bash", "-c", script)
-		output, err := cmd.CombinedOutput()
+		// The route parameters are handed to the script through its own environment.
+		res, err := executor.Run(r.Context(), Command{
+			Name: "bash",
+			Args: []string{"-c", script},
+			Env:  []string{"NINO_FOLDER=" + chi.URLParam(r, "folder"), "NINO_FILE=" + chi.URLParam(r, "filename")},
+		})
+		output := res.Combined()
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to execute command: %v\nOutput:\n%s", err, string(output)), http.StatusInternalServerError)
 			return
@@ -651,7 +702,7 @@ func execCommandHandler() http.HandlerFunc {
 }
 
 // fetchLinoExampleHandler fetches the first line of a table as an example for masking files.
-func fetchLinoExampleHandler(inputPaths []string, fileMap map[string]string) http.HandlerFunc {
+func fetchLinoExampleHandler(ws *Workspace, executor *Executor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		folderName := chi.URLParam(r, "folder")
 		fileName := chi.URLParam(r, "filename")
@@ -663,29 +714,18 @@ func fetchLinoExampleHandler(inputPaths []string, fileMap map[string]string) htt
 
 		tableName := strings.TrimSuffix(fileName, SUFFIX_MASKING)
 
-		// Find the base path for the folder to execute the lino command from.
-		basePath, ok := findBasePathForFolder(inputPaths, folderName, fileMap)
-		if !ok {
-			http.Error(w, fmt.Sprintf("Could not determine base path for folder '%s'", folderName), http.StatusInternalServerError)
-			return
-		}
-
-		// Change to the correct directory before executing the command
-		originalDir, err := os.Getwd()
+		// lino resolves its dataconnector.yaml from the working directory of the command.
+		targetDir, err := ws.FolderDir(folderName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to get current working directory: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Could not determine base path for folder '%s': %v", folderName, err), workspaceErrorStatus(err))
 			return
 		}
-		defer os.Chdir(originalDir) // Restore original directory
-
-		targetDir := filepath.Join(basePath, folderName)
-		if err := os.Chdir(targetDir); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to change directory to '%s': %v", targetDir, err), http.StatusInternalServerError)
-			return
-		}
-
-		cmd := exec.Command("lino", "pull", "--table", tableName, "source", "-l", "1")
-		output, err := cmd.CombinedOutput()
+		res, err := executor.Run(r.Context(), Command{
+			Name: "lino",
+			Args: []string{"pull", "--table", tableName, "source", "-l", "1"},
+			Dir:  targetDir,
+		})
+		output := res.Combined()
 		if err != nil {
 			log.Printf("Error executing lino pull command: %v\nOutput:\n%s", err, string(output))
 			http.Error(w, fmt.Sprintf("Failed to fetch example data: %v\n%s", err, string(output)), http.StatusInternalServerError)
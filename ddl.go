@@ -0,0 +1,749 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	TABLES_FILE    = "tables.yaml"
+	RELATIONS_FILE = "relations.yaml"
+	DDL_MAX_SIZE   = 32 << 20 // Largest schema dump uploaded, in bytes
+)
+
+// ddlToken is a word, a quoted identifier, a string literal or a punctuation character of SQL.
+type ddlToken struct {
+	text    string
+	quoted  bool // "name", `name` or [name]: never a keyword
+	literal bool // 'string' or $$dollar quoted$$
+}
+
+// ddlTable is a table read from CREATE TABLE and ALTER TABLE statements.
+type ddlTable struct {
+	name     string
+	keys     []string
+	columns  []Column
+	types    []string      // Declared SQL type of each column
+	defaults []interface{} // Constant DEFAULT value of each column, nil when it has none
+	options  []ddlToken
+}
+
+// ddlForeignKey is a FOREIGN KEY or REFERENCES constraint, whose parent keys may be implicit.
+type ddlForeignKey struct {
+	name       string
+	child      string
+	childKeys  []string
+	parent     string
+	parentKeys []string
+}
+
+// DDLSchema holds the tables and relations of a schema dump, in the order they are declared.
+type DDLSchema struct {
+	tables      []*ddlTable
+	byName      map[string]*ddlTable // Keyed by lower case name
+	foreignKeys []ddlForeignKey
+	pendingKeys map[string][]string // Primary keys added to tables not created yet, by lower case name
+	relations   []relationOutput
+	Warnings    []string
+}
+
+// DDLImportReport is the result of a DDL import.
+type DDLImportReport struct {
+	Files     []string `json:"files"`
+	Tables    int      `json:"tables"`
+	Relations int      `json:"relations"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// Relations written to relations.yaml: their ends only have a name and keys, unlike tables.
+type (
+	relationEndOutput struct {
+		Name string   `yaml:"name" json:"name"`
+		Keys []string `yaml:"keys" json:"keys"`
+	}
+	relationOutput struct {
+		Name   string            `yaml:"name"`
+		Parent relationEndOutput `yaml:"parent"`
+		Child  relationEndOutput `yaml:"child"`
+	}
+	relationSchemaOutput struct {
+		Version   string           `yaml:"version"`
+		Relations []relationOutput `yaml:"relations"`
+	}
+)
+
+// tokenizeDDL splits SQL into tokens, dropping whitespace and comments (--, # and /* */).
+func tokenizeDDL(sql string) []ddlToken {
+	runes := []rune(sql)
+	tokens := []ddlToken{}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexRunes(runes, i+2, []rune("*/"))
+			if end < 0 {
+				return tokens
+			}
+			i = end + 2
+		case r == '\'' || r == '"' || r == '`':
+			text, next := quotedDDL(runes, i)
+			tokens = append(tokens, ddlToken{text: text, quoted: r != '\'', literal: r == '\''})
+			i = next
+		case r == '[' && i+1 < len(runes) && (runes[i+1] == '_' || unicode.IsLetter(runes[i+1])):
+			// SQLite and SQL Server [quoted identifiers], unlike PostgreSQL array types like text[] or int[3]
+			end := indexRunes(runes, i+1, []rune("]"))
+			if end < 0 {
+				end = len(runes)
+			}
+			tokens = append(tokens, ddlToken{text: string(runes[i+1 : end]), quoted: true})
+			i = end + 1
+		case r == '$' && dollarTag(runes, i) != "":
+			tag := []rune(dollarTag(runes, i))
+			end := indexRunes(runes, i+len(tag), tag)
+			if end < 0 {
+				return append(tokens, ddlToken{text: string(runes[i+len(tag):]), literal: true})
+			}
+			tokens = append(tokens, ddlToken{text: string(runes[i+len(tag) : end]), literal: true})
+			i = end + len(tag)
+		case isDDLWordRune(r):
+			start := i
+			for i < len(runes) && (isDDLWordRune(runes[i]) || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, ddlToken{text: string(runes[start:i])})
+		default:
+			tokens = append(tokens, ddlToken{text: string(r)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// quotedDDL reads the quoted text starting at runes[start], a doubled quote standing for itself
+// (a backslash escapes in MySQL strings too). It returns the text and the index after the closing quote.
+func quotedDDL(runes []rune, start int) (string, int) {
+	quote := runes[start]
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && quote == '\'' && i+1 < len(runes):
+			i++
+			text.WriteRune(runes[i])
+		case runes[i] == quote && i+1 < len(runes) && runes[i+1] == quote:
+			i++
+			text.WriteRune(quote)
+		case runes[i] == quote:
+			return text.String(), i + 1
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return text.String(), len(runes)
+}
+
+// dollarTag returns the $tag$ opening a PostgreSQL dollar quoted string at runes[start], if any.
+func dollarTag(runes []rune, start int) string {
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '$':
+			return string(runes[start : i+1])
+		case !isDDLWordRune(runes[i]) || unicode.IsDigit(runes[i]) && i == start+1:
+			return ""
+		}
+	}
+	return ""
+}
+
+// indexRunes returns the index of the first occurrence of pattern in runes from the given index, or -1.
+func indexRunes(runes []rune, from int, pattern []rune) int {
+	for i := from; i+len(pattern) <= len(runes); i++ {
+		if string(runes[i:i+len(pattern)]) == string(pattern) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isDDLWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// is tells whether the token is the given keyword, quoted identifiers never being keywords.
+func (t ddlToken) is(keyword string) bool {
+	return !t.quoted && !t.literal && strings.EqualFold(t.text, keyword)
+}
+
+// name returns the identifier of the token as it is written. Tables are looked up regardless of the case
+// of their name, like in SQL, but keep the case of their declaration as MySQL and SQLite do.
+func (t ddlToken) name() string {
+	return t.text
+}
+
+// hasKeywords tells whether the tokens start with the given keywords.
+func hasKeywords(tokens []ddlToken, keywords ...string) bool {
+	if len(tokens) < len(keywords) {
+		return false
+	}
+	for i, keyword := range keywords {
+		if !tokens[i].is(keyword) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitDDL splits tokens on a separator outside of parentheses, like the statements on ";"
+// or the definitions of a table on ",".
+func splitDDL(tokens []ddlToken, separator string) [][]ddlToken {
+	parts := [][]ddlToken{}
+	depth, start := 0, 0
+	for i, token := range tokens {
+		switch {
+		case token.literal || token.quoted:
+		case token.text == "(":
+			depth++
+		case token.text == ")":
+			depth--
+		case token.text == separator && depth <= 0:
+			if i > start {
+				parts = append(parts, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, tokens[start:])
+	}
+	return parts
+}
+
+// qualifiedName reads a possibly schema qualified name, e.g. public."Owners", and returns the
+// table name without its schema, and the tokens after it.
+func qualifiedName(tokens []ddlToken) (string, []ddlToken) {
+	name := ""
+	for len(tokens) > 0 {
+		name = tokens[0].name()
+		tokens = tokens[1:]
+		if len(tokens) < 2 || tokens[0].text != "." || tokens[0].quoted {
+			break
+		}
+		tokens = tokens[1:]
+	}
+	return name, tokens
+}
+
+// isIndexDefinition tells whether a table definition is a MySQL index, like KEY idx (name) or FULLTEXT (body),
+// or a PostgreSQL EXCLUDE constraint. These keywords are not reserved in PostgreSQL, where key text or
+// index varchar(10) are columns: an index has its columns in parentheses, after an optional name and USING method.
+func isIndexDefinition(definition []ddlToken) bool {
+	if !definition[0].is("KEY") && !definition[0].is("INDEX") && !definition[0].is("FULLTEXT") && !definition[0].is("SPATIAL") && !definition[0].is("EXCLUDE") {
+		return false
+	}
+	rest := definition[1:]
+	if (definition[0].is("FULLTEXT") || definition[0].is("SPATIAL")) && len(rest) > 0 && (rest[0].is("KEY") || rest[0].is("INDEX")) {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && rest[0].text != "(" && !rest[0].is("USING") {
+		rest = rest[1:] // Index name
+	}
+	if hasKeywords(rest, "USING") && len(rest) > 1 {
+		rest = rest[2:]
+	}
+	inner, _, ok := parenthesized(rest)
+	// A column type has numbers in parentheses, like varchar(10), an index has columns.
+	return ok && len(inner) > 0 && (inner[0].quoted || (!inner[0].literal && inner[0].text != "" && !unicode.IsDigit([]rune(inner[0].text)[0])))
+}
+
+// parenthesized returns the tokens between the parenthesis opening the tokens and the one closing it,
+// and the tokens after it, or false when the tokens do not start with a parenthesis.
+func parenthesized(tokens []ddlToken) ([]ddlToken, []ddlToken, bool) {
+	if len(tokens) == 0 || tokens[0].text != "(" || tokens[0].quoted || tokens[0].literal {
+		return nil, tokens, false
+	}
+	depth := 0
+	for i, token := range tokens {
+		if token.quoted || token.literal {
+			continue
+		}
+		switch token.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return tokens[1:i], tokens[i+1:], true
+			}
+		}
+	}
+	return tokens[1:], nil, true
+}
+
+// columnList reads a parenthesized list of columns, ignoring their ordering or prefix length, e.g.
+// (last_name(10) DESC, first_name).
+func columnList(tokens []ddlToken) ([]string, []ddlToken, bool) {
+	inner, rest, ok := parenthesized(tokens)
+	if !ok {
+		return nil, tokens, false
+	}
+	columns := []string{}
+	for _, part := range splitDDL(inner, ",") {
+		columns = append(columns, part[0].name())
+	}
+	return columns, rest, true
+}
+
+// ParseDDL reads the tables, primary keys and foreign keys of PostgreSQL or MySQL DDL statements,
+// e.g. a pg_dump --schema-only or mysqldump --no-data output. Other statements are ignored.
+func ParseDDL(sql string) *DDLSchema {
+	schema := &DDLSchema{byName: map[string]*ddlTable{}, pendingKeys: map[string][]string{}}
+	for _, statement := range splitDDL(tokenizeDDL(sql), ";") {
+		switch {
+		case statement[0].is("CREATE"):
+			schema.createTable(statement[1:])
+		case hasKeywords(statement, "ALTER", "TABLE"):
+			schema.alterTable(statement[2:])
+		}
+	}
+	for _, table := range slices.Sorted(maps.Keys(schema.pendingKeys)) {
+		keys := strings.Join(schema.pendingKeys[table], ", ")
+		schema.Warnings = append(schema.Warnings, fmt.Sprintf("primary key (%s) of table '%s' which is not created", keys, table))
+	}
+	schema.resolveRelations()
+	return schema
+}
+
+// createTable reads CREATE [TEMPORARY|UNLOGGED...] TABLE [IF NOT EXISTS] name (definitions...).
+// Tables created AS SELECT, LIKE another or as a PARTITION OF another have no definitions to read.
+func (s *DDLSchema) createTable(tokens []ddlToken) {
+	for len(tokens) > 0 && !tokens[0].is("TABLE") {
+		if !tokens[0].is("GLOBAL") && !tokens[0].is("LOCAL") && !tokens[0].is("TEMP") && !tokens[0].is("TEMPORARY") && !tokens[0].is("UNLOGGED") {
+			return // CREATE INDEX, VIEW, FUNCTION...
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 2 {
+		return
+	}
+	tokens = tokens[1:]
+	if hasKeywords(tokens, "IF", "NOT", "EXISTS") {
+		tokens = tokens[3:]
+	}
+	name, tokens := qualifiedName(tokens)
+	definitions, options, ok := parenthesized(tokens)
+	if !ok {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("table '%s' has no column definitions", name))
+		return
+	}
+	if s.table(name) != nil {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("table '%s' is created twice, the last definition is kept", name))
+		s.removeTable(name)
+	}
+	table := &ddlTable{name: name, keys: s.pendingKeys[strings.ToLower(name)], columns: []Column{}, options: options}
+	delete(s.pendingKeys, strings.ToLower(name))
+	s.tables = append(s.tables, table)
+	s.byName[strings.ToLower(name)] = table
+
+	for _, definition := range splitDDL(definitions, ",") {
+		constraint := ""
+		if definition[0].is("CONSTRAINT") && len(definition) > 2 {
+			constraint = definition[1].name()
+			definition = definition[2:]
+		}
+		switch {
+		case hasKeywords(definition, "PRIMARY", "KEY"):
+			if keys, _, ok := columnList(definition[2:]); ok {
+				table.keys = keys
+			}
+		case hasKeywords(definition, "FOREIGN", "KEY"):
+			s.foreignKey(constraint, name, definition[2:])
+		case definition[0].is("UNIQUE"), definition[0].is("CHECK"), definition[0].is("LIKE"), isIndexDefinition(definition):
+		case constraint == "":
+			s.column(table, definition)
+		}
+	}
+}
+
+// column reads a column definition: its name, its type, and its inline PRIMARY KEY or REFERENCES constraints.
+func (s *DDLSchema) column(table *ddlTable, definition []ddlToken) {
+	name := definition[0].name()
+	sqlType := []string{}
+	rest := definition[1:]
+	for len(rest) > 0 && !isColumnConstraint(rest[0]) {
+		sqlType = append(sqlType, strings.ToLower(rest[0].text))
+		rest = rest[1:]
+	}
+	table.columns = append(table.columns, Column{Name: name, Export: ddlExportType(strings.Join(sqlType, " "))})
+	table.types = append(table.types, strings.Join(sqlType, " "))
+	table.defaults = append(table.defaults, nil)
+
+	constraint := ""
+	for i := 0; i < len(rest); i++ {
+		switch {
+		case rest[i].is("DEFAULT"):
+			table.defaults[len(table.defaults)-1] = ddlConstant(rest[i+1:])
+		case rest[i].is("CONSTRAINT") && i+1 < len(rest):
+			constraint = rest[i+1].name()
+			i++
+		case hasKeywords(rest[i:], "PRIMARY", "KEY"):
+			table.keys = []string{name}
+			constraint = ""
+		case rest[i].is("REFERENCES"):
+			s.references(constraint, table.name, []string{name}, rest[i+1:])
+			constraint = ""
+		}
+	}
+}
+
+// ddlConstant returns the value of a constant string or number, like the DEFAULT of a column, nil for an expression.
+func ddlConstant(tokens []ddlToken) interface{} {
+	if len(tokens) > 0 && tokens[0].literal {
+		return tokens[0].text
+	}
+	sign := ""
+	if len(tokens) > 1 && (tokens[0].text == "-" || tokens[0].text == "+") && !tokens[0].quoted {
+		sign, tokens = tokens[0].text, tokens[1:]
+	}
+	if len(tokens) == 0 || tokens[0].quoted || tokens[0].literal {
+		return nil
+	}
+	number := sign + tokens[0].text
+	if len(tokens) > 2 && tokens[1].text == "." && !tokens[2].quoted && !tokens[2].literal {
+		number += "." + tokens[2].text // 1.5 is tokenized as 1 . 5
+	}
+	if i, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f
+	}
+	return nil
+}
+
+// isColumnConstraint tells whether the token starts the constraints or options following a column type.
+func isColumnConstraint(token ddlToken) bool {
+	if token.literal || token.quoted {
+		return false
+	}
+	switch strings.ToUpper(token.text) {
+	case "CONSTRAINT", "NOT", "NULL", "DEFAULT", "PRIMARY", "REFERENCES", "UNIQUE", "CHECK", "COLLATE", "GENERATED",
+		"AUTO_INCREMENT", "AUTOINCREMENT", "COMMENT", "CHARACTER", "CHARSET", "IDENTITY", "ON", "AS", "STORAGE", "COMPRESSION", "INVISIBLE", "VISIBLE":
+		return true
+	}
+	return false
+}
+
+// foreignKey reads (columns) REFERENCES parent [(columns)] after FOREIGN KEY.
+func (s *DDLSchema) foreignKey(constraint, child string, tokens []ddlToken) {
+	columns, rest, ok := columnList(tokens)
+	if !ok || len(rest) == 0 || !rest[0].is("REFERENCES") {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("foreign key of table '%s' without references", child))
+		return
+	}
+	s.references(constraint, child, columns, rest[1:])
+}
+
+// references reads parent [(columns)] after REFERENCES, the parent columns defaulting to its primary key.
+func (s *DDLSchema) references(constraint, child string, childKeys []string, tokens []ddlToken) {
+	parent, rest := qualifiedName(tokens)
+	parentKeys, _, _ := columnList(rest)
+	s.foreignKeys = append(s.foreignKeys, ddlForeignKey{name: constraint, child: child, childKeys: childKeys, parent: parent, parentKeys: parentKeys})
+}
+
+// alterTable reads the primary and foreign keys added by ALTER TABLE [ONLY] [IF EXISTS] name ADD ...,
+// the way pg_dump writes them.
+func (s *DDLSchema) alterTable(tokens []ddlToken) {
+	if hasKeywords(tokens, "IF", "EXISTS") {
+		tokens = tokens[2:]
+	}
+	if len(tokens) > 0 && tokens[0].is("ONLY") {
+		tokens = tokens[1:]
+	}
+	name, tokens := qualifiedName(tokens)
+	for _, action := range splitDDL(tokens, ",") {
+		if !action[0].is("ADD") {
+			continue
+		}
+		action = action[1:]
+		constraint := ""
+		if len(action) > 2 && action[0].is("CONSTRAINT") {
+			constraint = action[1].name()
+			action = action[2:]
+		}
+		switch {
+		case hasKeywords(action, "PRIMARY", "KEY"):
+			keys, _, ok := columnList(action[2:])
+			if !ok {
+				continue
+			}
+			if table := s.table(name); table != nil {
+				table.keys = keys
+			} else {
+				s.pendingKeys[strings.ToLower(name)] = keys
+			}
+		case hasKeywords(action, "FOREIGN", "KEY"):
+			s.foreignKey(constraint, name, action[2:])
+		}
+	}
+}
+
+// table returns the table of the given name, whatever its case, nil when it is not created.
+func (s *DDLSchema) table(name string) *ddlTable {
+	return s.byName[strings.ToLower(name)]
+}
+
+// removeTable forgets a table and its foreign keys, before it is created again.
+func (s *DDLSchema) removeTable(name string) {
+	delete(s.byName, strings.ToLower(name))
+	tables := s.tables[:0]
+	for _, table := range s.tables {
+		if !strings.EqualFold(table.name, name) {
+			tables = append(tables, table)
+		}
+	}
+	s.tables = tables
+	foreignKeys := s.foreignKeys[:0]
+	for _, fk := range s.foreignKeys {
+		if !strings.EqualFold(fk.child, name) {
+			foreignKeys = append(foreignKeys, fk)
+		}
+	}
+	s.foreignKeys = foreignKeys
+}
+
+// ddlExportType maps an SQL column type to the export type of tables.yaml.
+// Booleans are exported as numeric, like lino extracts them, and binary values as base64.
+func ddlExportType(sqlType string) string {
+	base := strings.TrimSpace(strings.SplitN(sqlType, "(", 2)[0])
+	base = strings.TrimSuffix(strings.TrimSuffix(base, " unsigned"), " zerofill")
+	switch {
+	case strings.HasSuffix(base, "[]") || strings.Contains(sqlType, "array"):
+		return "string"
+	case strings.HasPrefix(base, "timestamp"), strings.HasPrefix(base, "time"), base == "date", base == "datetime", base == "year":
+		return "datetime"
+	}
+	switch base {
+	case "smallint", "integer", "int", "int2", "int4", "int8", "bigint", "tinyint", "mediumint", "serial", "smallserial",
+		"bigserial", "serial4", "serial8", "decimal", "dec", "numeric", "real", "float", "float4", "float8", "double",
+		"double precision", "money", "bit", "boolean", "bool":
+		return "numeric"
+	case "bytea", "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary":
+		return "base64"
+	}
+	return "string"
+}
+
+// Tables returns the tables of tables.yaml, with their keys and the export type of their columns.
+func (s *DDLSchema) Tables() []Table {
+	tables := []Table{}
+	for _, table := range s.tables {
+		keys := table.keys
+		if keys == nil {
+			keys = []string{}
+		}
+		tables = append(tables, Table{Name: table.name, Keys: keys, Columns: table.columns})
+	}
+	return tables
+}
+
+// resolveRelations turns the foreign keys into the relations of relations.yaml, named after their
+// constraint or, when it has no name, fk_<child>_<parent>. Implicit parent keys are the primary key of the parent.
+func (s *DDLSchema) resolveRelations() {
+	s.relations = []relationOutput{}
+	names := map[string]int{}
+	for _, fk := range s.foreignKeys {
+		// Tables are named as they are created, whatever the case they are referenced with.
+		if child := s.table(fk.child); child != nil {
+			fk.child = child.name
+		}
+		parent := s.table(fk.parent)
+		if parent != nil {
+			fk.parent = parent.name
+		} else {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("foreign key of '%s' references '%s' which is not created", fk.child, fk.parent))
+		}
+		parentKeys := fk.parentKeys
+		if parentKeys == nil {
+			if parent == nil {
+				continue
+			}
+			if len(parent.keys) == 0 {
+				s.Warnings = append(s.Warnings, fmt.Sprintf("foreign key of '%s' references '%s' which has no primary key", fk.child, fk.parent))
+				continue
+			}
+			parentKeys = parent.keys
+		}
+		if len(parentKeys) != len(fk.childKeys) {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("foreign key of '%s' has %d columns but references %d", fk.child, len(fk.childKeys), len(parentKeys)))
+			continue
+		}
+		name := fk.name
+		if name == "" {
+			name = fmt.Sprintf("fk_%s_%s", fk.child, fk.parent)
+		}
+		if names[name]++; names[name] > 1 {
+			name = fmt.Sprintf("%s_%d", name, names[name])
+		}
+		s.relations = append(s.relations, relationOutput{
+			Name:   name,
+			Parent: relationEndOutput{Name: fk.parent, Keys: parentKeys},
+			Child:  relationEndOutput{Name: fk.child, Keys: fk.childKeys},
+		})
+	}
+}
+
+// importDDL parses a schema dump and renders its tables.yaml and relations.yaml, in the layout lino writes them.
+func importDDL(sql string) (tablesContent, relationsContent []byte, schema *DDLSchema, err error) {
+	schema = ParseDDL(sql)
+	if len(schema.tables) == 0 {
+		return nil, nil, schema, errors.New("no CREATE TABLE statement found")
+	}
+	if tablesContent, err = encodeYAML(TableSchema{Version: "v1", Tables: schema.Tables()}); err != nil {
+		return nil, nil, schema, err
+	}
+	if relationsContent, err = encodeYAML(relationSchemaOutput{Version: "v1", Relations: schema.relations}); err != nil {
+		return nil, nil, schema, err
+	}
+	return tablesContent, relationsContent, schema, nil
+}
+
+// encodeYAML renders a value in block style with an indentation of 2 spaces.
+func encodeYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+// importDDLCommand runs `nino import-ddl`, writing the tables.yaml and relations.yaml of a schema dump.
+func importDDLCommand(args []string) error {
+	flags := flag.NewFlagSet("import-ddl", flag.ExitOnError)
+	output := flags.String("o", ".", "Directory where tables.yaml and relations.yaml are written.")
+	force := flags.Bool("f", false, "Replace the existing tables.yaml and relations.yaml.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import-ddl [-o directory] [-f] <schema.sql or ->\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Generates tables.yaml and relations.yaml from the CREATE TABLE, PRIMARY KEY and FOREIGN KEY statements of a PostgreSQL or MySQL schema.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("expected one SQL file")
+	}
+
+	var sql []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		sql, err = io.ReadAll(os.Stdin)
+	} else {
+		sql, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	tablesContent, relationsContent, schema, err := importDDL(string(sql))
+	if err != nil {
+		return err
+	}
+	for _, warning := range schema.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+
+	files := map[string][]byte{
+		filepath.Join(*output, TABLES_FILE):    tablesContent,
+		filepath.Join(*output, RELATIONS_FILE): relationsContent,
+	}
+	if !*force {
+		for path := range files {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("'%s' already exists, add -f to replace it", path)
+			}
+		}
+	}
+	if err := os.MkdirAll(*output, 0755); err != nil {
+		return err
+	}
+	for path, content := range files {
+		if err := writeFileAtomic(path, content); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d tables and %d relations written to %s\n", len(schema.tables), len(schema.relations), *output)
+	return nil
+}
+
+// importDDLHandler generates the tables.yaml and relations.yaml of a folder from the SQL schema posted.
+// Existing files are only replaced with ?overwrite=true, their content being kept in the file history.
+func importDDLHandler(store *ProjectStore, ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		sql, err := io.ReadAll(http.MaxBytesReader(w, r.Body, DDL_MAX_SIZE))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read the schema: %v", err), http.StatusRequestEntityTooLarge)
+			return
+		}
+		tablesContent, relationsContent, schema, err := importDDL(string(sql))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to import the schema: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		folderDir, err := ws.FolderDir(folderName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		overwrite := r.URL.Query().Get("overwrite") == "true"
+		tablesPath, relationsPath := filepath.Join(folderDir, TABLES_FILE), filepath.Join(folderDir, RELATIONS_FILE)
+		if !overwrite {
+			for _, path := range []string{tablesPath, relationsPath} {
+				if _, err := os.Stat(path); err == nil {
+					http.Error(w, fmt.Sprintf("file '%s' already exists, add ?overwrite=true to replace it", filepath.Base(path)), http.StatusConflict)
+					return
+				}
+			}
+		}
+		for path, content := range map[string][]byte{tablesPath: tablesContent, relationsPath: relationsContent} {
+			if err := ws.WriteFileAt(path, content, overwrite); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to write %s: %v", filepath.Base(path), err), workspaceErrorStatus(err))
+				return
+			}
+		}
+		log.Printf("importDDLHandler: imported %d tables into %s", len(schema.tables), folderDir)
+		reloadSchemas(store)
+
+		report := DDLImportReport{Tables: len(schema.tables), Relations: len(schema.relations), Warnings: schema.Warnings}
+		for _, path := range []string{tablesPath, relationsPath} {
+			relPath, _ := ws.RelPath(path)
+			report.Files = append(report.Files, relPath)
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Failed to encode DDL import report to JSON: %v", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pgDumpSample is a schema as pg_dump --schema-only writes it: keys added by ALTER TABLE ONLY,
+// dollar quoted function bodies, quoted identifiers and array types.
+const pgDumpSample = `
+--
+-- PostgreSQL database dump
+--
+SET statement_timeout = 0;
+
+CREATE FUNCTION public.last_updated() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.last_update = CURRENT_TIMESTAMP; -- CREATE TABLE fake (id int);
+    RETURN NEW;
+END $$;
+
+CREATE TABLE public.customer (
+    customer_id integer DEFAULT nextval('public.customer_customer_id_seq'::regclass) NOT NULL,
+    store_id smallint NOT NULL,
+    "First Name" character varying(45) NOT NULL,
+    active boolean DEFAULT true NOT NULL,
+    create_date date DEFAULT ('now'::text)::date NOT NULL,
+    tags text[],
+    picture bytea
+);
+
+CREATE TABLE public.store (
+    store_id integer NOT NULL,
+    manager_staff_id smallint NOT NULL
+);
+
+/* the rental table */
+CREATE TABLE public.rental (
+    rental_id integer NOT NULL,
+    rental_date timestamp with time zone NOT NULL,
+    customer_id smallint NOT NULL,
+    store_id integer
+);
+
+ALTER TABLE ONLY public.customer
+    ADD CONSTRAINT customer_pkey PRIMARY KEY (customer_id);
+
+ALTER TABLE ONLY public.store
+    ADD CONSTRAINT store_pkey PRIMARY KEY (store_id);
+
+ALTER TABLE ONLY public.rental
+    ADD CONSTRAINT rental_pkey PRIMARY KEY (rental_id);
+
+ALTER TABLE ONLY public.customer
+    ADD CONSTRAINT customer_store_id_fkey FOREIGN KEY (store_id) REFERENCES public.store(store_id) ON UPDATE CASCADE;
+
+ALTER TABLE ONLY public.rental
+    ADD CONSTRAINT rental_customer_id_fkey FOREIGN KEY (customer_id) REFERENCES public.customer(customer_id);
+
+ALTER TABLE ONLY public.rental
+    ADD FOREIGN KEY (store_id) REFERENCES public.store;
+
+CREATE INDEX idx_fk_store_id ON public.customer USING btree (store_id);
+`
+
+// mysqlDumpSample is a schema as mysqldump --no-data writes it: backquoted identifiers, inline keys,
+// conditional comments and table options.
+const mysqlDumpSample = "" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"DROP TABLE IF EXISTS `Owners`;\n" +
+	"CREATE TABLE `Owners` (\n" +
+	"  `id` int(11) NOT NULL AUTO_INCREMENT,\n" +
+	"  `name` varchar(30) DEFAULT 'n/a' COMMENT 'full name; with a semicolon',\n" +
+	"  `balance` decimal(10,2) DEFAULT '0.00',\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `idx_name` (`name`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+	"# pets reference owners\n" +
+	"CREATE TABLE `pets` (\n" +
+	"  `id` int(11) NOT NULL,\n" +
+	"  `owner_id` int(11) DEFAULT NULL,\n" +
+	"  `birth` datetime,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  CONSTRAINT `fk_pets_owners` FOREIGN KEY (`owner_id`) REFERENCES `owners` (`id`)\n" +
+	") ENGINE=InnoDB;\n" +
+	"CREATE TABLE `visits` (\n" +
+	"  `pet_id` int(11) NOT NULL REFERENCES `pets` (`id`),\n" +
+	"  `vet_id` int(11) REFERENCES `vets` (`id`)\n" +
+	");\n"
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		tables    []Table
+		relations []relationOutput
+		warnings  int
+	}{
+		{
+			name: "pg_dump",
+			sql:  pgDumpSample,
+			tables: []Table{
+				{Name: "customer", Keys: []string{"customer_id"}, Columns: []Column{
+					{Name: "customer_id", Export: "numeric"},
+					{Name: "store_id", Export: "numeric"},
+					{Name: "First Name", Export: "string"},
+					{Name: "active", Export: "numeric"},
+					{Name: "create_date", Export: "datetime"},
+					{Name: "tags", Export: "string"},
+					{Name: "picture", Export: "base64"},
+				}},
+				{Name: "store", Keys: []string{"store_id"}, Columns: []Column{
+					{Name: "store_id", Export: "numeric"},
+					{Name: "manager_staff_id", Export: "numeric"},
+				}},
+				{Name: "rental", Keys: []string{"rental_id"}, Columns: []Column{
+					{Name: "rental_id", Export: "numeric"},
+					{Name: "rental_date", Export: "datetime"},
+					{Name: "customer_id", Export: "numeric"},
+					{Name: "store_id", Export: "numeric"},
+				}},
+			},
+			relations: []relationOutput{
+				{Name: "customer_store_id_fkey", Parent: relationEndOutput{Name: "store", Keys: []string{"store_id"}}, Child: relationEndOutput{Name: "customer", Keys: []string{"store_id"}}},
+				{Name: "rental_customer_id_fkey", Parent: relationEndOutput{Name: "customer", Keys: []string{"customer_id"}}, Child: relationEndOutput{Name: "rental", Keys: []string{"customer_id"}}},
+				{Name: "fk_rental_store", Parent: relationEndOutput{Name: "store", Keys: []string{"store_id"}}, Child: relationEndOutput{Name: "rental", Keys: []string{"store_id"}}},
+			},
+		},
+		{
+			name: "mysqldump",
+			sql:  mysqlDumpSample,
+			tables: []Table{
+				{Name: "Owners", Keys: []string{"id"}, Columns: []Column{
+					{Name: "id", Export: "numeric"},
+					{Name: "name", Export: "string"},
+					{Name: "balance", Export: "numeric"},
+				}},
+				{Name: "pets", Keys: []string{"id"}, Columns: []Column{
+					{Name: "id", Export: "numeric"},
+					{Name: "owner_id", Export: "numeric"},
+					{Name: "birth", Export: "datetime"},
+				}},
+				{Name: "visits", Keys: []string{}, Columns: []Column{
+					{Name: "pet_id", Export: "numeric"},
+					{Name: "vet_id", Export: "numeric"},
+				}},
+			},
+			relations: []relationOutput{
+				{Name: "fk_pets_owners", Parent: relationEndOutput{Name: "Owners", Keys: []string{"id"}}, Child: relationEndOutput{Name: "pets", Keys: []string{"owner_id"}}},
+				{Name: "fk_visits_pets", Parent: relationEndOutput{Name: "pets", Keys: []string{"id"}}, Child: relationEndOutput{Name: "visits", Keys: []string{"pet_id"}}},
+				{Name: "fk_visits_vets", Parent: relationEndOutput{Name: "vets", Keys: []string{"id"}}, Child: relationEndOutput{Name: "visits", Keys: []string{"vet_id"}}},
+			},
+			warnings: 1, // vets is not created
+		},
+		{
+			name: "primary key added before its table",
+			sql: `ALTER TABLE ONLY b ADD CONSTRAINT b_pkey PRIMARY KEY (id);
+				CREATE TABLE a (id int PRIMARY KEY, b_id int REFERENCES b);
+				CREATE TABLE b (id int);`,
+			tables: []Table{
+				{Name: "a", Keys: []string{"id"}, Columns: []Column{{Name: "id", Export: "numeric"}, {Name: "b_id", Export: "numeric"}}},
+				{Name: "b", Keys: []string{"id"}, Columns: []Column{{Name: "id", Export: "numeric"}}},
+			},
+			relations: []relationOutput{
+				{Name: "fk_a_b", Parent: relationEndOutput{Name: "b", Keys: []string{"id"}}, Child: relationEndOutput{Name: "a", Keys: []string{"b_id"}}},
+			},
+		},
+		{
+			name: "index keywords as column names",
+			sql: `CREATE TABLE settings (
+					key text PRIMARY KEY, index int, fulltext varchar(10), exclude numeric(3, 1),
+					KEY idx_index (index), INDEX (fulltext(5)), FULLTEXT KEY ft (fulltext), KEY idx_exclude USING BTREE (exclude)
+				);`,
+			tables: []Table{
+				{Name: "settings", Keys: []string{"key"}, Columns: []Column{
+					{Name: "key", Export: "string"},
+					{Name: "index", Export: "numeric"},
+					{Name: "fulltext", Export: "string"},
+					{Name: "exclude", Export: "numeric"},
+				}},
+			},
+			relations: []relationOutput{},
+		},
+		{
+			name: "implicit parent key without primary key",
+			sql:  `CREATE TABLE a (id int); CREATE TABLE b (a_id int REFERENCES a);`,
+			tables: []Table{
+				{Name: "a", Keys: []string{}, Columns: []Column{{Name: "id", Export: "numeric"}}},
+				{Name: "b", Keys: []string{}, Columns: []Column{{Name: "a_id", Export: "numeric"}}},
+			},
+			relations: []relationOutput{},
+			warnings:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schema := ParseDDL(test.sql)
+			if tables := schema.Tables(); !reflect.DeepEqual(tables, test.tables) {
+				t.Errorf("tables:\n got %+v\nwant %+v", tables, test.tables)
+			}
+			if !reflect.DeepEqual(schema.relations, test.relations) {
+				t.Errorf("relations:\n got %+v\nwant %+v", schema.relations, test.relations)
+			}
+			if len(schema.Warnings) != test.warnings {
+				t.Errorf("warnings: got %q, want %d", schema.Warnings, test.warnings)
+			}
+		})
+	}
+}
+
+func TestTokenizeDDL(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []ddlToken
+	}{
+		{"comments", "a -- b\n# c\n/* d */ e", []ddlToken{{text: "a"}, {text: "e"}}},
+		{"double quotes", `"My ""Table"""`, []ddlToken{{text: `My "Table"`, quoted: true}}},
+		{"backquotes", "`order`", []ddlToken{{text: "order", quoted: true}}},
+		{"brackets", "[Order Details] int[3]", []ddlToken{{text: "Order Details", quoted: true}, {text: "int"}, {text: "["}, {text: "3"}, {text: "]"}}},
+		{"string", `'it''s'`, []ddlToken{{text: "it's", literal: true}}},
+		{"dollar quotes", "$body$ a; 'b' $body$ c", []ddlToken{{text: " a; 'b' ", literal: true}, {text: "c"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := tokenizeDDL(test.sql); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	EVENT_PROJECT_CHANGED = "project-changed"
+	CONTENT_TYPE_SSE      = "text/event-stream"
+)
+
+// ProjectEvent is pushed to connected browsers when a new project revision is published.
+type ProjectEvent struct {
+	Type     string   `json:"type"`
+	Revision uint64   `json:"revision"`
+	ETag     string   `json:"etag"`
+	Files    []string `json:"files"` // Files added, modified or removed since the previous revision.
+}
+
+// eventHub fans out project events to every subscribed SSE connection.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan ProjectEvent]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[chan ProjectEvent]struct{})}
+}
+
+// subscribe registers a new listener. The channel is buffered so a slow browser never blocks a reload.
+func (h *eventHub) subscribe() chan ProjectEvent {
+	ch := make(chan ProjectEvent, 8)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan ProjectEvent) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// publish sends the event to every listener, dropping it for listeners whose buffer is full.
+func (h *eventHub) publish(event ProjectEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Warning: dropping %s event for a slow subscriber", event.Type)
+		}
+	}
+}
+
+// eventsHandler streams project events to the browser using Server-Sent Events.
+func eventsHandler(hub *eventHub, store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		events := hub.subscribe()
+		defer hub.unsubscribe(events)
+
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_SSE)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		// Tell the browser which revision it is looking at, so it can detect missed events on reconnect.
+		snap := store.Snapshot()
+		fmt.Fprintf(w, "retry: 3000\nid: %d\n\n", snap.Revision)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(25 * time.Second)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Printf("Error encoding %s event: %v", event.Type, err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", event.Type, event.Revision, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Command describes a single invocation of an external tool (lino, pimo, dot, bash...).
+// Every command carries its own working directory and environment so that
+// concurrent requests never depend on, nor modify, the process-wide state.
+type Command struct {
+	Name  string
+	Args  []string
+	Dir   string    // Working directory of the tool. Defaults to the executor's directory.
+	Env   []string  // Extra "KEY=value" entries appended to the executor's environment.
+	Stdin io.Reader // Optional standard input.
+}
+
+// String renders the command line for logging purposes.
+func (c Command) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// CommandResult holds the captured outputs of a finished command.
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	Output   []byte // Stdout and stderr interleaved in the order they were written
+	ExitCode int
+}
+
+// Combined returns stdout and stderr interleaved, as CombinedOutput would.
+func (res CommandResult) Combined() []byte {
+	return res.Output
+}
+
+// lockedWriter serializes the writes of stdout and stderr to their shared output buffer,
+// which exec copies from two goroutines.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (lw lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// Executor runs external tools with an isolated working directory and environment per call.
+// It never calls os.Chdir nor os.Setenv, so it is safe to share between concurrent handlers.
+type Executor struct {
+	dir string   // Default working directory for commands without an explicit Dir.
+	env []string // Base environment, captured once at startup.
+}
+
+// newExecutor creates an executor whose default working directory is dir.
+// An empty dir means the current working directory at creation time.
+func newExecutor(dir string) *Executor {
+	if dir == "" {
+		if wd, err := os.Getwd(); err == nil {
+			dir = wd
+		}
+	}
+	return &Executor{dir: dir, env: os.Environ()}
+}
+
+// Run executes the command and waits for it to finish. The process is killed when ctx is done,
+// typically when the HTTP client disconnects. A non-zero exit code is returned as an error,
+// together with whatever output the command produced.
+func (e *Executor) Run(ctx context.Context, c Command) (CommandResult, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = e.dir
+	}
+	cmd.Env = append(append([]string{}, e.env...), c.Env...)
+	cmd.Stdin = c.Stdin
+
+	var stdout, stderr, output bytes.Buffer
+	var mu sync.Mutex
+	cmd.Stdout = lockedWriter{&mu, io.MultiWriter(&stdout, &output)}
+	cmd.Stderr = lockedWriter{&mu, io.MultiWriter(&stderr, &output)}
+
+	log.Printf("Executing command in '%s': %s", cmd.Dir, c)
+	err := cmd.Run()
+	res := CommandResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), Output: output.Bytes()}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return res, fmt.Errorf("failed to run %s: %w", c.Name, err)
+		}
+		return res, fmt.Errorf("%s exited with code %d: %w", c.Name, res.ExitCode, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Node types of the file tree.
+const (
+	NODE_FOLDER = "folder"
+	NODE_FILE   = "file"
+)
+
+// Parse statuses of the YAML files of the file tree.
+const (
+	PARSE_OK      = "ok"      // Parsed, possibly with validation errors
+	PARSE_ERROR   = "error"   // Could not be read or is not valid YAML
+	PARSE_IGNORED = "ignored" // Not loaded in the project, e.g. under a skipped folder
+)
+
+// Nino file types, detected from the file name.
+const (
+	FILE_MASKING       = "masking"
+	FILE_DESCRIPTOR    = "descriptor"
+	FILE_TABLES        = "tables"
+	FILE_RELATIONS     = "relations"
+	FILE_ANALYZE       = "analyze"
+	FILE_DATACONNECTOR = "dataconnector"
+	FILE_PLAYBOOK      = "playbook"
+	FILE_BASH          = "bash"
+	FILE_SQLITE        = "sqlite" // SQLite database, read as tables, relations and analysis
+	FILE_YAML          = "yaml"   // Any other YAML file
+)
+
+// FileNode is a file or a folder of the workspace tree served by /api/files.
+type FileNode struct {
+	Name        string      `json:"name"`
+	Path        string      `json:"path"`                  // Workspace path, as used by /api/file
+	Type        string      `json:"type"`                  // NODE_FOLDER or NODE_FILE
+	Kind        string      `json:"kind,omitempty"`        // Nino file type, see fileKind
+	Size        int64       `json:"size"`                  // In bytes, 0 for folders
+	ModTime     time.Time   `json:"modTime"`               // Last modification time
+	ParseStatus string      `json:"parseStatus,omitempty"` // YAML files and SQLite databases only, see PARSE_*
+	ErrorCount  int         `json:"errorCount"`            // Errors of the file, or of all the files of a folder
+	Errors      []string    `json:"errors,omitempty"`      // Parse error or validation errors of the file
+	Git         string      `json:"git,omitempty"`         // Git status, see GIT_*
+	Children    []*FileNode `json:"children,omitempty"`
+}
+
+// fileKind detects the nino file type of a file from its name, or its header for SQLite databases,
+// "" for files nino does not know.
+func fileKind(path string) string {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if ext == ".sh" {
+		return FILE_BASH
+	}
+	if isSQLiteFile(path) {
+		return FILE_SQLITE
+	}
+	if ext != ".yaml" && ext != ".yml" {
+		return ""
+	}
+	switch {
+	case strings.HasSuffix(base, "-masking"):
+		return FILE_MASKING
+	case strings.HasSuffix(base, "-descriptor"):
+		return FILE_DESCRIPTOR
+	case base == "tables" || base == "target-tables":
+		return FILE_TABLES
+	case base == "relations":
+		return FILE_RELATIONS
+	case base == "analyze" || base == "target-analyze":
+		return FILE_ANALYZE
+	case base == "dataconnector":
+		return FILE_DATACONNECTOR
+	case base == "playbook":
+		return FILE_PLAYBOOK
+	default:
+		return FILE_YAML
+	}
+}
+
+// fileTreeBuilder annotates the nodes with the parse results of the project snapshot and the git status.
+type fileTreeBuilder struct {
+	ws    *Workspace
+	files map[string]FileStatus // Parse results, keyed by absolute path
+	git   map[string]string     // Git status, keyed by workspace path
+}
+
+// buildWorkspaceTree lists the files of every input path. The content of the current directory
+// input is flattened at the top level, other input folders are top-level folders.
+func buildWorkspaceTree(ws *Workspace, snap *projectSnapshot, gitStatus map[string]string) ([]*FileNode, error) {
+	builder := &fileTreeBuilder{ws: ws, files: snap.Files, git: gitStatus}
+	nodes := make([]*FileNode, 0)
+	for _, root := range ws.roots {
+		if root.file != "" {
+			info, err := os.Stat(filepath.Join(root.dir, root.file))
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, builder.fileNode(filepath.Join(root.dir, root.file), root.file, info))
+			continue
+		}
+
+		children, err := builder.children(root.dir, root.name)
+		if err != nil {
+			return nil, err
+		}
+		if root.name == "" {
+			nodes = append(nodes, children...)
+			continue
+		}
+		info, err := os.Stat(root.dir)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, builder.folderNode(root.name, root.name, info, children))
+	}
+	return nodes, nil
+}
+
+// children lists the nodes of a folder, folders first then files, each sorted by name.
+// Hidden files and folders, the 'public' folder and symlinks leaving the workspace are skipped.
+func (b *fileTreeBuilder) children(dir, relDir string) ([]*FileNode, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*FileNode, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || name == "public" {
+			continue
+		}
+		fullPath := filepath.Join(dir, name)
+		if entry.Type()&fs.ModeSymlink != 0 && !b.ws.Contains(fullPath) {
+			continue
+		}
+		info, err := os.Stat(fullPath) // Follows symlinks
+		if err != nil {
+			continue
+		}
+		relPath := name
+		if relDir != "" {
+			relPath = relDir + "/" + name
+		}
+
+		if info.IsDir() {
+			children, err := b.children(fullPath, relPath)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, b.folderNode(name, relPath, info, children))
+		} else if info.Mode().IsRegular() {
+			nodes = append(nodes, b.fileNode(fullPath, relPath, info))
+		}
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Type != nodes[j].Type {
+			return nodes[i].Type == NODE_FOLDER
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
+
+// folderNode creates a folder node, whose error count sums the ones of its content.
+func (b *fileTreeBuilder) folderNode(name, relPath string, info fs.FileInfo, children []*FileNode) *FileNode {
+	node := &FileNode{Name: name, Path: relPath, Type: NODE_FOLDER, ModTime: info.ModTime(), Children: children}
+	for _, child := range children {
+		node.ErrorCount += child.ErrorCount
+	}
+	return node
+}
+
+// fileNode creates a file node, with the parse result of YAML files and SQLite databases.
+func (b *fileTreeBuilder) fileNode(fullPath, relPath string, info fs.FileInfo) *FileNode {
+	node := &FileNode{
+		Name:    filepath.Base(relPath),
+		Path:    relPath,
+		Type:    NODE_FILE,
+		Kind:    fileKind(fullPath),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Git:     b.git[relPath],
+	}
+	if node.Kind == "" || node.Kind == FILE_BASH {
+		return node
+	}
+
+	status, ok := b.files[fullPath]
+	switch {
+	case !ok:
+		node.ParseStatus = PARSE_IGNORED
+	case status.Error != "":
+		node.ParseStatus, node.Errors = PARSE_ERROR, []string{status.Error}
+	default:
+		node.ParseStatus, node.Errors = PARSE_OK, status.Problems
+	}
+	node.ErrorCount = len(node.Errors)
+	return node
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Git file statuses, as reported in /api/git/status and /api/files.
+const (
+	GIT_UNTRACKED  = "untracked"
+	GIT_MODIFIED   = "modified"
+	GIT_ADDED      = "added"
+	GIT_DELETED    = "deleted"
+	GIT_RENAMED    = "renamed"
+	GIT_CONFLICTED = "conflicted"
+)
+
+var (
+	// errNotInGitRepository is returned for a file which is not part of any local git repository.
+	errNotInGitRepository = errors.New("file is not in a git repository")
+	// errNothingToCommit is returned when committing without any staged change.
+	errNothingToCommit = errors.New("nothing to commit, stage files first")
+)
+
+// GitFileStatus is the git status of one workspace file.
+type GitFileStatus struct {
+	Index    string `json:"index"`    // Status letter in the index (git status --porcelain X column)
+	WorkTree string `json:"worktree"` // Status letter in the working tree (Y column)
+	Status   string `json:"status"`   // One of the GIT_* statuses
+	Staged   bool   `json:"staged"`   // Whether the change is in the index, ready to be committed
+}
+
+// GitStatus is the git status of the workspace: the repositories found and the changed files keyed by workspace path.
+type GitStatus struct {
+	Repositories []string                 `json:"repositories"`
+	Files        map[string]GitFileStatus `json:"files"`
+}
+
+// GitCommit describes a commit created in one repository.
+type GitCommit struct {
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+	Summary    string `json:"summary"`
+}
+
+// gitRepo is a local git repository, driven through the git CLI.
+type gitRepo struct {
+	dir      string // Top-level directory of the working tree
+	executor *Executor
+}
+
+// git runs a git command in the repository. Optional locks are disabled so that
+// reading the status never competes with the user's own git commands.
+func (repo *gitRepo) git(ctx context.Context, args ...string) (CommandResult, error) {
+	return repo.executor.Run(ctx, Command{
+		Name: "git",
+		Args: args,
+		Dir:  repo.dir,
+		Env:  []string{"GIT_TERMINAL_PROMPT=0", "GIT_OPTIONAL_LOCKS=0"},
+	})
+}
+
+// rel returns the path of a file relative to the repository, or false if it is not inside.
+func (repo *gitRepo) rel(fullPath string) (string, bool) {
+	rel, err := filepath.Rel(repo.dir, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// status parses `git status --porcelain -z`, keyed by absolute path.
+func (repo *gitRepo) status(ctx context.Context) (map[string]GitFileStatus, error) {
+	res, err := repo.git(ctx, "status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, res.Stderr)
+	}
+	statuses := make(map[string]GitFileStatus)
+	entries := strings.Split(string(res.Stdout), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		x, y, path := entry[0], entry[1], entry[3:]
+		if x == 'R' || x == 'C' {
+			i++ // The original path of a rename or copy follows
+		}
+		statuses[filepath.Join(repo.dir, filepath.FromSlash(path))] = parseGitStatus(x, y)
+	}
+	return statuses, nil
+}
+
+// parseGitStatus interprets the two status letters of `git status --porcelain`.
+func parseGitStatus(x, y byte) GitFileStatus {
+	status := GitFileStatus{Index: string(x), WorkTree: string(y), Staged: x != ' ' && x != '?'}
+	switch {
+	case x == '?':
+		status.Status = GIT_UNTRACKED
+	case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+		status.Status, status.Staged = GIT_CONFLICTED, false
+	case y == 'M':
+		status.Status = GIT_MODIFIED
+	case y == 'D' || x == 'D':
+		status.Status = GIT_DELETED
+	case x == 'A':
+		status.Status = GIT_ADDED
+	case x == 'R' || x == 'C':
+		status.Status = GIT_RENAMED
+	default:
+		status.Status = GIT_MODIFIED
+	}
+	return status
+}
+
+// GitWorkspace gives access to the local git repositories holding the workspace input paths.
+// Nothing ever talks to a remote.
+type GitWorkspace struct {
+	ws       *Workspace
+	executor *Executor
+}
+
+// newGitWorkspace creates the git access for a workspace.
+func newGitWorkspace(ws *Workspace, executor *Executor) *GitWorkspace {
+	return &GitWorkspace{ws: ws, executor: executor}
+}
+
+// repos returns the distinct repositories of the input paths. Input paths outside of any repository are ignored.
+func (g *GitWorkspace) repos(ctx context.Context) []*gitRepo {
+	seen := make(map[string]bool)
+	var repos []*gitRepo
+	for _, root := range g.ws.roots {
+		probe := &gitRepo{dir: root.dir, executor: g.executor}
+		res, err := probe.git(ctx, "rev-parse", "--show-toplevel")
+		if err != nil {
+			continue
+		}
+		top := strings.TrimSpace(string(res.Stdout))
+		if real, err := filepath.EvalSymlinks(top); err == nil {
+			top = real
+		}
+		if !seen[top] {
+			seen[top] = true
+			repos = append(repos, &gitRepo{dir: top, executor: g.executor})
+		}
+	}
+	return repos
+}
+
+// repoOf returns the repository holding an absolute path.
+func (g *GitWorkspace) repoOf(ctx context.Context, fullPath string) (*gitRepo, string, error) {
+	for _, repo := range g.repos(ctx) {
+		if rel, ok := repo.rel(fullPath); ok {
+			return repo, rel, nil
+		}
+	}
+	return nil, "", errNotInGitRepository
+}
+
+// Status returns the changed files of the workspace, keyed by workspace path.
+// The .nino history folders are left out.
+func (g *GitWorkspace) Status(ctx context.Context) (GitStatus, error) {
+	status := GitStatus{Repositories: []string{}, Files: make(map[string]GitFileStatus)}
+	for _, repo := range g.repos(ctx) {
+		status.Repositories = append(status.Repositories, repo.dir)
+		statuses, err := repo.status(ctx)
+		if err != nil {
+			return status, err
+		}
+		for fullPath, fileStatus := range statuses {
+			relPath, ok := g.ws.RelPath(fullPath)
+			if !ok || strings.Contains("/"+relPath+"/", "/"+HISTORY_DIR+"/") {
+				continue
+			}
+			status.Files[relPath] = fileStatus
+		}
+	}
+	return status, nil
+}
+
+// Diff returns the unified diff of a workspace file against HEAD, staged and unstaged changes included.
+// An untracked file, or any file before the first commit, is diffed against an empty file.
+func (g *GitWorkspace) Diff(ctx context.Context, relPath string) (string, error) {
+	fullPath, err := g.ws.Resolve(relPath)
+	if err != nil {
+		return "", err
+	}
+	repo, rel, err := g.repoOf(ctx, fullPath)
+	if err != nil {
+		return "", err
+	}
+	statuses, err := repo.status(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if statuses[fullPath].Status == GIT_UNTRACKED {
+		// `git diff --no-index` exits with 1 when the files differ.
+		res, err := repo.git(ctx, "diff", "--no-index", "--", os.DevNull, rel)
+		if err != nil && res.ExitCode != 1 {
+			return "", fmt.Errorf("%w: %s", err, res.Stderr)
+		}
+		return string(res.Stdout), nil
+	}
+	base, err := repo.head(ctx)
+	if err != nil {
+		return "", err
+	}
+	res, err := repo.git(ctx, "diff", base, "--", rel)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, res.Stderr)
+	}
+	return string(res.Stdout), nil
+}
+
+// head returns HEAD, or the empty tree when the repository has no commit yet.
+func (repo *gitRepo) head(ctx context.Context) (string, error) {
+	if _, err := repo.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		return "HEAD", nil
+	}
+	res, err := repo.git(ctx, "hash-object", "-t", "tree", os.DevNull)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, res.Stderr)
+	}
+	return strings.TrimSpace(string(res.Stdout)), nil
+}
+
+// Stage adds the given workspace files (or folders) to the index, deletions included.
+// The .nino history folders are never staged.
+func (g *GitWorkspace) Stage(ctx context.Context, relPaths []string) error {
+	repos := g.repos(ctx)
+	byRepo := make(map[*gitRepo][]string)
+	for _, relPath := range relPaths {
+		fullPath, err := g.ws.Resolve(relPath)
+		if err != nil {
+			return fmt.Errorf("'%s': %w", relPath, err)
+		}
+		found := false
+		for _, repo := range repos {
+			if rel, ok := repo.rel(fullPath); ok {
+				byRepo[repo], found = append(byRepo[repo], rel), true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("'%s': %w", relPath, errNotInGitRepository)
+		}
+	}
+	for _, repo := range repos {
+		if len(byRepo[repo]) == 0 {
+			continue
+		}
+		args := append([]string{"add", "-A", "--"}, byRepo[repo]...)
+		res, err := repo.git(ctx, append(args, ":(exclude,glob)**/"+HISTORY_DIR+"/**")...)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, res.Stderr)
+		}
+	}
+	return nil
+}
+
+// Commit commits the staged changes of every repository having some, with the same message.
+func (g *GitWorkspace) Commit(ctx context.Context, message string) ([]GitCommit, error) {
+	commits := []GitCommit{}
+	for _, repo := range g.repos(ctx) {
+		// `git diff --cached --quiet` exits with 1 when changes are staged.
+		res, err := repo.git(ctx, "diff", "--cached", "--quiet")
+		if err == nil {
+			continue
+		}
+		if res.ExitCode != 1 {
+			return commits, fmt.Errorf("%w: %s", err, res.Stderr)
+		}
+		if res, err := repo.git(ctx, "commit", "-m", message); err != nil {
+			return commits, fmt.Errorf("%w: %s%s", err, res.Stdout, res.Stderr)
+		}
+		res, err = repo.git(ctx, "log", "-1", "--format=%h %s")
+		if err != nil {
+			return commits, fmt.Errorf("%w: %s", err, res.Stderr)
+		}
+		hash, summary, _ := strings.Cut(strings.TrimSpace(string(res.Stdout)), " ")
+		commits = append(commits, GitCommit{Repository: repo.dir, Commit: hash, Summary: summary})
+	}
+	if len(commits) == 0 {
+		return commits, errNothingToCommit
+	}
+	return commits, nil
+}
+
+// gitErrorStatus maps git errors onto HTTP status codes.
+func gitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNothingToCommit):
+		return http.StatusConflict
+	case errors.Is(err, errNotInGitRepository):
+		return http.StatusNotFound
+	default:
+		return workspaceErrorStatus(err)
+	}
+}
+
+// gitStatusHandler serves the git status of the workspace files.
+func gitStatusHandler(git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := git.Status(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get git status: %v", err), gitErrorStatus(err))
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Failed to encode git status to JSON: %v", err)
+		}
+	}
+}
+
+// gitDiffHandler serves the diff of a workspace file against HEAD.
+func gitDiffHandler(git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filepathParam := chi.URLParam(r, "*")
+		diff, err := git.Diff(r.Context(), filepathParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to diff '%s': %v", filepathParam, err), gitErrorStatus(err))
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, "text/x-diff; charset=utf-8")
+		fmt.Fprint(w, diff)
+	}
+}
+
+// GitStageRequest defines the structure for the /api/git/stage request body.
+type GitStageRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// gitStageHandler stages workspace files and returns the new git status.
+func gitStageHandler(git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GitStageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(req.Paths) == 0 {
+			http.Error(w, "'paths' must list at least one file", http.StatusBadRequest)
+			return
+		}
+		if err := git.Stage(r.Context(), req.Paths); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to stage files: %v", err), gitErrorStatus(err))
+			return
+		}
+		gitStatusHandler(git)(w, r)
+	}
+}
+
+// GitCommitRequest defines the structure for the /api/git/commit request body.
+type GitCommitRequest struct {
+	Message string `json:"message"`
+}
+
+// gitCommitHandler commits the staged changes.
+func gitCommitHandler(git *GitWorkspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req GitCommitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			http.Error(w, "A commit 'message' is required", http.StatusBadRequest)
+			return
+		}
+		commits, err := git.Commit(r.Context(), req.Message)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to commit: %v", err), gitErrorStatus(err))
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(commits); err != nil {
+			log.Printf("Failed to encode commits to JSON: %v", err)
+		}
+	}
+}
+
+// gitCommand implements `nino git status|diff|add|commit`, on the repository of the current directory.
+func gitCommand(args []string) error {
+	flags := flag.NewFlagSet("git", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s git status | diff <file> | add <files...> | commit -m <message>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing git subcommand")
+	}
+
+	ws, err := newWorkspace([]string{"."})
+	if err != nil {
+		return err
+	}
+	git := newGitWorkspace(ws, newExecutor(""))
+	ctx := context.Background()
+	subArgs := flags.Args()[1:]
+
+	switch flags.Arg(0) {
+	case "status":
+		status, err := git.Status(ctx)
+		if err != nil {
+			return err
+		}
+		paths := make([]string, 0, len(status.Files))
+		for path := range status.Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("%s%s %-10s %s\n", status.Files[path].Index, status.Files[path].WorkTree, status.Files[path].Status, path)
+		}
+	case "diff":
+		if len(subArgs) != 1 {
+			return errors.New("usage: git diff <file>")
+		}
+		diff, err := git.Diff(ctx, subArgs[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(diff)
+	case "add":
+		if len(subArgs) == 0 {
+			return errors.New("usage: git add <files...>")
+		}
+		return git.Stage(ctx, subArgs)
+	case "commit":
+		commitFlags := flag.NewFlagSet("git commit", flag.ExitOnError)
+		message := commitFlags.String("m", "", "Commit message.")
+		commitFlags.Parse(subArgs)
+		if strings.TrimSpace(*message) == "" {
+			return errors.New("usage: git commit -m <message>")
+		}
+		commits, err := git.Commit(ctx, *message)
+		if err != nil {
+			return err
+		}
+		for _, commit := range commits {
+			fmt.Printf("✅ [%s] %s (%s)\n", commit.Commit, commit.Summary, commit.Repository)
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown git subcommand '%s'", flags.Arg(0))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGitTestWorkspace creates a workspace in a new git repository without any commit,
+// holding a tables.yaml file, and returns the workspace path of the repository.
+func newGitTestWorkspace(t *testing.T) (*Workspace, *GitWorkspace, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// The executor captures the environment: the repository must not depend on the user's configuration.
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "nino")
+	t.Setenv("GIT_AUTHOR_EMAIL", "nino@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "nino")
+	t.Setenv("GIT_COMMITTER_EMAIL", "nino@example.com")
+
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tables.yaml"), []byte("version: v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ws, err := newWorkspace([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ws, newGitWorkspace(ws, newExecutor(dir)), filepath.Base(dir)
+}
+
+func TestGitStatusAndDiffBeforeFirstCommit(t *testing.T) {
+	_, git, root := newGitTestWorkspace(t)
+	ctx := context.Background()
+	tables := root + "/tables.yaml"
+
+	status, err := git.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status.Files[tables]; got.Status != GIT_UNTRACKED || got.Staged {
+		t.Errorf("status %+v, want untracked", got)
+	}
+	diff, err := git.Diff(ctx, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+version: v1") {
+		t.Errorf("untracked diff:\n%s", diff)
+	}
+
+	// Once staged, the file is diffed against the empty tree, as there is no HEAD yet.
+	if err := git.Stage(ctx, []string{tables}); err != nil {
+		t.Fatal(err)
+	}
+	status, err = git.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status.Files[tables]; got.Status != GIT_ADDED || !got.Staged {
+		t.Errorf("status %+v, want added and staged", got)
+	}
+	diff, err = git.Diff(ctx, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+version: v1") {
+		t.Errorf("staged diff without commit:\n%s", diff)
+	}
+}
+
+func TestGitStageAndCommit(t *testing.T) {
+	ws, git, root := newGitTestWorkspace(t)
+	ctx := context.Background()
+	tables := root + "/tables.yaml"
+
+	if _, err := git.Commit(ctx, "nothing"); !errors.Is(err, errNothingToCommit) {
+		t.Errorf("commit without staged files: %v, want errNothingToCommit", err)
+	}
+	if err := git.Stage(ctx, []string{root}); err != nil {
+		t.Fatal(err)
+	}
+	commits, err := git.Commit(ctx, "Add tables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].Summary != "Add tables" {
+		t.Errorf("commits %+v, want one 'Add tables'", commits)
+	}
+
+	// Writing through the workspace keeps a revision under .nino, which is never shown nor staged.
+	if _, err := ws.WriteFile(tables, []byte("version: v2\n")); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := git.Diff(ctx, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "-version: v1") || !strings.Contains(diff, "+version: v2") {
+		t.Errorf("diff against HEAD:\n%s", diff)
+	}
+	if err := git.Stage(ctx, []string{root}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := git.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path := range status.Files {
+		if path != tables {
+			t.Errorf("unexpected change %s", path)
+		}
+	}
+	res, err := git.repos(ctx)[0].git(ctx, "diff", "--cached", "--name-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged := strings.Fields(string(res.Stdout)); len(staged) != 1 || staged[0] != "tables.yaml" {
+		t.Errorf("staged %v, want only tables.yaml", staged)
+	}
+	if _, err := git.Commit(ctx, "Update tables"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	// HISTORY_DIR is the reserved folder, at the top of each input path, holding the file revisions.
+	HISTORY_DIR = ".nino"
+	// HISTORY_LIMIT is the number of revisions kept per file, older ones are pruned.
+	HISTORY_LIMIT = 50
+	// historySuffix keeps revisions out of the YAML discovery.
+	historySuffix = ".rev"
+	// historyTimeFormat makes revision IDs sort chronologically.
+	historyTimeFormat = "20060102T150405.000000000Z"
+	// REVISION_CURRENT designates the current content of the file in diffs.
+	REVISION_CURRENT = "current"
+)
+
+// errRevisionNotFound is returned for an unknown revision ID.
+var errRevisionNotFound = errors.New("revision not found")
+
+// FileRevision is a previous content of a workspace file, saved before it was overwritten or deleted.
+type FileRevision struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+	ETag string    `json:"etag"`
+}
+
+// FileHistory lists the revisions of a file, the most recent first.
+type FileHistory struct {
+	Path      string         `json:"path"`
+	Exists    bool           `json:"exists"`
+	ETag      string         `json:"etag,omitempty"` // ETag of the current content
+	Revisions []FileRevision `json:"revisions"`
+}
+
+// historyDir returns the folder holding the revisions of an absolute workspace file,
+// e.g. "<input>/.nino/history/source/tables.yaml/".
+func (ws *Workspace) historyDir(fullPath string) (string, error) {
+	for _, root := range ws.roots {
+		rel, err := filepath.Rel(root.dir, fullPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		return filepath.Join(root.dir, HISTORY_DIR, "history", rel), nil
+	}
+	return "", errOutsideWorkspace
+}
+
+// saveRevision copies the current content of a file into its history before it is replaced.
+// Missing files and contents identical to the latest revision are not saved. ws.mu must be held.
+func (ws *Workspace) saveRevision(fullPath string) error {
+	content, err := os.ReadFile(fullPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dir, err := ws.historyDir(fullPath)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	revisions, err := listRevisions(dir)
+	if err != nil {
+		return err
+	}
+	if len(revisions) > 0 && strings.HasSuffix(revisions[0], "-"+hash[:12]) {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	id := time.Now().UTC().Format(historyTimeFormat) + "-" + hash[:12]
+	if err := writeFileAtomic(filepath.Join(dir, id+historySuffix), content); err != nil {
+		return err
+	}
+	log.Printf("Saved revision %s of %s", id, fullPath)
+
+	// Prune the oldest revisions.
+	if len(revisions) >= HISTORY_LIMIT {
+		for _, old := range revisions[HISTORY_LIMIT-1:] {
+			os.Remove(filepath.Join(dir, old+historySuffix))
+		}
+	}
+	return nil
+}
+
+// saveRevisions saves the revision of a file, or of every file of a folder about to be deleted. ws.mu must be held.
+func (ws *Workspace) saveRevisions(fullPath string) error {
+	return filepath.WalkDir(fullPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == HISTORY_DIR {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return ws.saveRevision(path)
+	})
+}
+
+// moveHistory moves the revisions of a renamed file or folder. ws.mu must be held.
+func (ws *Workspace) moveHistory(from, to string) {
+	fromDir, err := ws.historyDir(from)
+	if err != nil {
+		return
+	}
+	toDir, err := ws.historyDir(to)
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(fromDir); err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(toDir), 0755); err == nil {
+		if err := os.Rename(fromDir, toDir); err != nil {
+			log.Printf("Failed to move the history of %s: %v", from, err)
+		}
+	}
+}
+
+// listRevisions returns the revision IDs found in a history folder, the most recent first.
+func listRevisions(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), historySuffix) {
+			ids = append(ids, strings.TrimSuffix(entry.Name(), historySuffix))
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// History lists the revisions of a workspace file, which may have been deleted since.
+func (ws *Workspace) History(relPath string) (FileHistory, error) {
+	fullPath, err := ws.Resolve(relPath)
+	if err != nil {
+		return FileHistory{}, err
+	}
+	dir, err := ws.historyDir(fullPath)
+	if err != nil {
+		return FileHistory{}, err
+	}
+	ids, err := listRevisions(dir)
+	if err != nil {
+		return FileHistory{}, err
+	}
+
+	history := FileHistory{Path: relPath, Revisions: make([]FileRevision, 0, len(ids))}
+	if content, err := os.ReadFile(fullPath); err == nil {
+		history.Exists, history.ETag = true, contentETag(content)
+	}
+	if !history.Exists && len(ids) == 0 {
+		return FileHistory{}, fmt.Errorf("file '%s': %w", relPath, errNotInWorkspace)
+	}
+	for _, id := range ids {
+		content, err := os.ReadFile(filepath.Join(dir, id+historySuffix))
+		if err != nil {
+			return FileHistory{}, err
+		}
+		revision := FileRevision{ID: id, Size: int64(len(content)), ETag: contentETag(content)}
+		if stamp, _, ok := strings.Cut(id, "-"); ok {
+			revision.Time, _ = time.Parse(historyTimeFormat, stamp)
+		}
+		history.Revisions = append(history.Revisions, revision)
+	}
+	return history, nil
+}
+
+// Revision returns the content of a revision of a workspace file, or its current content for REVISION_CURRENT.
+func (ws *Workspace) Revision(relPath, id string) ([]byte, error) {
+	if id == REVISION_CURRENT {
+		return ws.ReadFile(relPath)
+	}
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") {
+		return nil, errRevisionNotFound
+	}
+	fullPath, err := ws.Resolve(relPath)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ws.historyDir(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(dir, id+historySuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("revision '%s' of '%s': %w", id, relPath, errRevisionNotFound)
+	}
+	return content, err
+}
+
+// Restore replaces a workspace file, or recreates it if deleted, with one of its revisions.
+// The content being replaced is itself saved as a new revision.
+func (ws *Workspace) Restore(relPath, id string) (string, []byte, error) {
+	content, err := ws.Revision(relPath, id)
+	if err != nil {
+		return "", nil, err
+	}
+	fullPath, err := ws.WriteFile(relPath, content)
+	return fullPath, content, err
+}
+
+// diffRevisions returns the unified diff between two revisions of a workspace file.
+func diffRevisions(ws *Workspace, relPath, from, to string) (string, error) {
+	a, err := ws.Revision(relPath, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := ws.Revision(relPath, to)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: relPath + "@" + from,
+		ToFile:   relPath + "@" + to,
+		Context:  3,
+	})
+}
+
+// fileHistoryHandler serves the revisions of a workspace file:
+// the list by default, one revision with ?rev=, or a unified diff with ?from= (and optionally &to=, defaulting to the current content).
+func fileHistoryHandler(ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filepathParam := chi.URLParam(r, "*")
+		query := r.URL.Query()
+
+		switch {
+		case query.Get("rev") != "":
+			content, err := ws.Revision(filepathParam, query.Get("rev"))
+			if err != nil {
+				http.Error(w, err.Error(), historyErrorStatus(err))
+				return
+			}
+			w.Header().Set("ETag", contentETag(content))
+			w.Header().Set(CONTENT_TYPE, "text/plain; charset=utf-8")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+
+		case query.Get("from") != "":
+			to := query.Get("to")
+			if to == "" {
+				to = REVISION_CURRENT
+			}
+			diff, err := diffRevisions(ws, filepathParam, query.Get("from"), to)
+			if err != nil {
+				http.Error(w, err.Error(), historyErrorStatus(err))
+				return
+			}
+			w.Header().Set(CONTENT_TYPE, "text/x-diff; charset=utf-8")
+			fmt.Fprint(w, diff)
+
+		default:
+			history, err := ws.History(filepathParam)
+			if err != nil {
+				http.Error(w, err.Error(), historyErrorStatus(err))
+				return
+			}
+			w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+			if err := json.NewEncoder(w).Encode(history); err != nil {
+				log.Printf("Failed to encode file history to JSON: %v", err)
+			}
+		}
+	}
+}
+
+// restoreFileHandler restores the revision given by ?rev= of a workspace file.
+func restoreFileHandler(ws *Workspace, store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filepathParam := chi.URLParam(r, "*")
+		id := r.URL.Query().Get("rev")
+		if id == "" || id == REVISION_CURRENT {
+			http.Error(w, "The 'rev' query parameter must name a revision", http.StatusBadRequest)
+			return
+		}
+
+		fullPath, content, err := ws.Restore(filepathParam, id)
+		if err != nil {
+			log.Printf("restoreFileHandler: Error restoring %s to %s: %v", filepathParam, id, err)
+			http.Error(w, err.Error(), historyErrorStatus(err))
+			return
+		}
+		log.Printf("restoreFileHandler: Restored %s to revision %s", fullPath, id)
+
+		reloadSchemas(store)
+
+		w.Header().Set("ETag", contentETag(content))
+		fmt.Fprintf(w, "File %s restored to revision %s", filepathParam, id)
+	}
+}
+
+// historyErrorStatus maps history errors onto HTTP status codes.
+func historyErrorStatus(err error) int {
+	if errors.Is(err, errRevisionNotFound) {
+		return http.StatusNotFound
+	}
+	return workspaceErrorStatus(err)
+}
@@ -7,23 +7,41 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 )
 
 // Global flags
 var (
-	daemonMode bool
-	port       string
-	baseFolder string
-	baseTable  string
-	plotColumn string
+	daemonMode    bool
+	port          string
+	baseFolder    string
+	baseTable     string
+	plotColumn    string
+	watchInterval time.Duration
 )
 
 //go:embed public
 var embeddedFiles embed.FS
 
+// subcommands are run as `nino <name> args...`, instead of the default graph generation.
+var subcommands = map[string]func(args []string) error{
+	"git":        gitCommand,
+	"analyze":    analyzeCommand,
+	"import-ddl": importDDLCommand,
+	"order":      orderCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			return
+		}
+	}
 
 	// Create a sub-filesystem from the embedded "public" directory.
 	// This is important if your HTML directly references assets like /css/style.css
@@ -43,6 +61,7 @@ func main() {
 	flag.StringVar(&baseTable, "t", "", "Table to run nino from. ")
 	// flag.StringVar(&plotColumn, "column", "", "Base column to run nino from.")
 	flag.StringVar(&plotColumn, "c", "", "Column to run nino from. ")
+	flag.DurationVar(&watchInterval, "w", time.Second, "Polling interval of the file watcher in daemon mode, 0 disables it. ")
 
 	flag.Parse()
 
@@ -52,9 +71,9 @@ func main() {
 		log.Fatalf("Error: No input files or folders provided. Usage: %s <file/folder paths...>", os.Args[0])
 	}
 
-	fileMap, err := findYAMLFiles(inputPaths)
+	fileMap, err := findSchemaFiles(inputPaths)
 	if err != nil {
-		log.Fatalf("Error finding YAML files: %v", err)
+		log.Fatalf("Error finding schema files: %v", err)
 	}
 
 	// Create a flat list for logging purposes
@@ -62,7 +81,7 @@ func main() {
 	for file := range fileMap {
 		fileList = append(fileList, file)
 	}
-	log.Printf("Found %d YAML files to process: %v", len(fileList), fileList)
+	log.Printf("Found %d schema files to process: %v", len(fileList), fileList)
 
 	schemas, err := inferAllSchemas(fileMap)
 	if err != nil {
@@ -81,7 +100,7 @@ func main() {
 func handleExecutionMode(projectData ProjectData, fileMap map[string]string, inputPaths []string, plotTable, plotColumn string, daemonMode bool, port string, publicFS fs.FS) {
 	if daemonMode {
 		log.Println("Starting in daemon mode...")
-		startDaemon(projectData, fileMap, inputPaths, port, publicFS)
+		startDaemon(fileMap, inputPaths, port, publicFS)
 		return
 	}
 	if plotTable != "" {
@@ -100,7 +119,7 @@ func handleExecutionMode(projectData ProjectData, fileMap map[string]string, inp
 		}
 	} else {
 		// Default mode: generate the main graph.
-		dotString := generateCombinedDotGraph(projectData)
+		dotString := generateCombinedDotGraph(projectData, nil)
 		writeFile("schema.dot", dotString)
 		// dotJS := fmt.Sprintf("const dot = `%s`;", dotString)
 		// writeFile("schema.js", dotJS)
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// errMaskNotFound is returned for a column without masking rule.
+var errMaskNotFound = errors.New("no masking rule for this column")
+
+// ColumnMask is the masking rule of a single column, as served and edited by /api/masking.
+// A rule holds either a single mask or a list of masks applied in sequence.
+type ColumnMask struct {
+	Folder   string        `json:"folder"`
+	Table    string        `json:"table"`
+	Column   string        `json:"column"`
+	File     string        `json:"file"`            // Workspace path of the masking file
+	Mask     interface{}   `json:"mask,omitempty"`  // e.g. {"regex": "[0-9]{10}"}
+	Masks    []interface{} `json:"masks,omitempty"` // e.g. [{"add-transient": "x"}, {"template": "{{.x}}"}]
+	Cache    string        `json:"cache,omitempty"`
+	Preserve string        `json:"preserve,omitempty"` // Read only, e.g. "null"
+	Seed     interface{}   `json:"seed,omitempty"`     // Read only, overrides the seed of the file
+}
+
+// maskEdit is the new rule of a column: exactly one of Mask and Masks, and optionally a cache,
+// which is removed when empty and left unchanged when missing. Nodes keep the key order of the request.
+type maskEdit struct {
+	Mask  *yaml.Node
+	Masks *yaml.Node
+	Cache *string
+}
+
+// parseMaskEdit reads a JSON (or YAML) rule like {"mask": {...}, "cache": "..."} or {"masks": [...]}.
+func parseMaskEdit(body []byte) (maskEdit, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(body, &node); err != nil {
+		return maskEdit{}, err
+	}
+	if len(node.Content) != 1 || node.Content[0].Kind != yaml.MappingNode {
+		return maskEdit{}, errors.New(`the body must be an object like {"mask": {...}} or {"masks": [...]}`)
+	}
+	rule := node.Content[0]
+
+	edit := maskEdit{Mask: mappingValue(rule, "mask"), Masks: mappingValue(rule, "masks")}
+	switch {
+	case (edit.Mask == nil) == (edit.Masks == nil):
+		return maskEdit{}, errors.New("exactly one of 'mask' and 'masks' must be given")
+	case edit.Mask != nil && edit.Mask.Kind != yaml.MappingNode:
+		return maskEdit{}, errors.New("'mask' must be an object")
+	case edit.Masks != nil && (edit.Masks.Kind != yaml.SequenceNode || len(edit.Masks.Content) == 0):
+		return maskEdit{}, errors.New("'masks' must be a non-empty list")
+	}
+	if cache := mappingValue(rule, "cache"); cache != nil {
+		if cache.Kind != yaml.ScalarNode {
+			return maskEdit{}, errors.New("'cache' must be a string")
+		}
+		edit.Cache = &cache.Value
+	}
+	return edit, nil
+}
+
+// readColumnMask extracts the rule of a column from the content of a masking file.
+func readColumnMask(content []byte, column string) (ColumnMask, error) {
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return ColumnMask{}, err
+	}
+	seq := mappingValue(doc.root, "masking")
+	i := maskingRuleIndex(seq, column)
+	if i < 0 {
+		return ColumnMask{}, fmt.Errorf("column '%s': %w", column, errMaskNotFound)
+	}
+
+	rule := seq.Content[i]
+	mask := ColumnMask{
+		Column:   column,
+		Cache:    scalarValue(mappingValue(rule, "cache")),
+		Preserve: scalarValue(mappingValue(rule, "preserve")),
+	}
+	if node := mappingValue(rule, "seed"); node != nil {
+		if err := node.Decode(&mask.Seed); err != nil {
+			return ColumnMask{}, err
+		}
+	}
+	if node := mappingValue(rule, "mask"); node != nil {
+		if err := node.Decode(&mask.Mask); err != nil {
+			return ColumnMask{}, err
+		}
+	}
+	if node := mappingValue(rule, "masks"); node != nil {
+		if err := node.Decode(&mask.Masks); err != nil {
+			return ColumnMask{}, err
+		}
+	}
+	return mask, nil
+}
+
+// maskingRule returns the i-th masking rule of the document and the end of its lines.
+func (doc *yamlDocument) maskingRule(i int) (*yaml.Node, int) {
+	seq := mappingValue(doc.root, "masking")
+	_, end := doc.itemLines(seq, i)
+	return seq.Content[i], end
+}
+
+// setRuleEntry replaces the entry of a key in the i-th masking rule with the entry rendered from value,
+// or inserts it after the entry of the key named after (at the end of the rule when missing).
+// A nil value removes the entry. The lines of the other entries, comments included, are kept.
+func (doc *yamlDocument) setRuleEntry(i int, key string, value interface{}, after string) error {
+	return doc.replaceRuleEntry(i, key, key, value, after)
+}
+
+// replaceRuleEntry is setRuleEntry where the entry of the key old is replaced by the entry of key.
+func (doc *yamlDocument) replaceRuleEntry(i int, old, key string, value interface{}, after string) error {
+	rule, limit := doc.maskingRule(i)
+	indent := rule.Content[0].Column - 1
+	var lines []string
+	if value != nil {
+		var err error
+		if lines, err = entryLines(indent, key, value); err != nil {
+			return err
+		}
+	}
+
+	keyNode, valueNode := mappingEntry(rule, old)
+	if keyNode == nil {
+		if value == nil {
+			return nil
+		}
+		at := limit
+		if afterKey, afterValue := mappingEntry(rule, after); afterKey != nil {
+			_, at = doc.entrySpan(afterKey, afterValue, limit)
+		}
+		return doc.splice(at, 0, lines...)
+	}
+
+	start, end := doc.entrySpan(keyNode, valueNode, limit)
+	if keyNode.Line == rule.Line {
+		// The first key of the rule shares its line with the dash of the item.
+		if value == nil {
+			return fmt.Errorf("'%s' is the first key of its rule, it cannot be removed", old)
+		}
+		lines[0] = doc.lines[start][:indent] + strings.TrimLeft(lines[0], " ")
+	}
+	return doc.splice(start, end-start, lines...)
+}
+
+// setColumnMask sets the rule of a column in the content of a masking file, appending a rule when the
+// column has none. The mask replaces the previous mask or masks in place. Returns whether a rule was added.
+func setColumnMask(content []byte, column string, edit maskEdit) ([]byte, bool, error) {
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key, value, other := "mask", edit.Mask, "masks"
+	if edit.Masks != nil {
+		key, value, other = "masks", edit.Masks, "mask"
+	}
+
+	i := maskingRuleIndex(mappingValue(doc.root, "masking"), column)
+	added := i < 0
+	if added {
+		err = doc.appendMaskingRules(func(indent int) []string {
+			pad := strings.Repeat(" ", indent)
+			lines := []string{pad + "- selector:", fmt.Sprintf("%s    jsonpath: \"%s\"", pad, column)}
+			entry, _ := entryLines(indent+2, key, value)
+			return append(lines, entry...)
+		})
+		i = maskingRuleIndex(mappingValue(doc.root, "masking"), column)
+	} else {
+		// Replace whichever of "mask" and "masks" comes first, and drop the other one.
+		rule, _ := doc.maskingRule(i)
+		target := key
+		if otherKey, _ := mappingEntry(rule, other); otherKey != nil {
+			if ownKey, _ := mappingEntry(rule, key); ownKey == nil || otherKey.Line < ownKey.Line {
+				target = other
+			}
+		}
+		if target == other {
+			err = doc.setRuleEntry(i, key, nil, "")
+		}
+		if err == nil {
+			err = doc.replaceRuleEntry(i, target, key, value, "selector")
+		}
+		if err == nil && target == key {
+			err = doc.setRuleEntry(i, other, nil, "")
+		}
+	}
+	if err != nil {
+		return nil, added, err
+	}
+
+	if edit.Cache != nil {
+		var cache interface{}
+		if *edit.Cache != "" {
+			cache = *edit.Cache
+		}
+		if err := doc.setRuleEntry(i, "cache", cache, key); err != nil {
+			return nil, added, err
+		}
+		if *edit.Cache != "" {
+			if err := doc.ensureCache(*edit.Cache); err != nil {
+				return nil, added, err
+			}
+		}
+	}
+	return doc.bytes(), added, nil
+}
+
+// deleteColumnMask removes the rule of a column from the content of a masking file,
+// with the flag comment of a removed column just above it.
+func deleteColumnMask(content []byte, column string) ([]byte, error) {
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	seq := mappingValue(doc.root, "masking")
+	i := maskingRuleIndex(seq, column)
+	if i < 0 {
+		return nil, fmt.Errorf("column '%s': %w", column, errMaskNotFound)
+	}
+	start, end := doc.itemLines(seq, i)
+	if start > 0 && strings.HasPrefix(strings.TrimSpace(doc.lines[start-1]), MASK_REMOVED_FLAG) {
+		start--
+	}
+	if err := doc.splice(start, end-start); err != nil {
+		return nil, err
+	}
+	return doc.bytes(), nil
+}
+
+// maskingColumnHandler reads (GET), sets (PUT) or removes (DELETE) the masking rule of a single column,
+// editing the masking file of its table in place. An If-Match header is checked against the ETag of the
+// masking file when given. PUT creates the masking file when missing.
+func maskingColumnHandler(store *ProjectStore, ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		tableName := chi.URLParam(r, "table")
+		// The column may be followed by the path of a JSON sub-field, e.g. "address.city".
+		column, err := url.PathUnescape(chi.URLParam(r, "column"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid column: %v", err), http.StatusBadRequest)
+			return
+		}
+		name, field := normalizeSelector(column)
+		column = selectorPath(name, field)
+		snap := store.Snapshot()
+
+		tableFolder, table, err := findTableLocation(snap.Data, tableName, folderName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if !slices.ContainsFunc(table.Columns, func(col Column) bool { return col.Name == name }) {
+			http.Error(w, fmt.Sprintf("column '%s' not found in table '%s'", name, tableName), http.StatusNotFound)
+			return
+		}
+		filePath, err := maskingFilePath(ws, tableFolder, tableName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			content, err := os.ReadFile(filePath)
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, fmt.Sprintf("table '%s' has no masking file", tableName), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeColumnMask(w, ws, filePath, tableFolder, tableName, column, content, http.StatusOK)
+			return
+		}
+
+		var edit maskEdit
+		if r.Method == http.MethodPut {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+				return
+			}
+			if edit, err = parseMaskEdit(body); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid masking rule: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ifMatch := r.Header.Get("If-Match")
+		var updated []byte
+		created, invalid := false, false
+		err = ws.UpdateFileAt(filePath, func(content []byte, exists bool) ([]byte, error) {
+			switch {
+			case !exists && r.Method == http.MethodDelete:
+				return nil, fmt.Errorf("table '%s' has no masking file: %w", tableName, errMaskNotFound)
+			case !exists:
+				content, created = newMaskingFile(*table), true
+			case ifMatch != "" && !etagMatches(ifMatch, contentETag(content)):
+				return nil, fmt.Errorf("masking file of '%s': %w", tableName, errModified)
+			}
+
+			var err error
+			if r.Method == http.MethodDelete {
+				updated, err = deleteColumnMask(content, column)
+			} else {
+				updated, _, err = setColumnMask(content, column, edit)
+			}
+			invalid = err != nil && !errors.Is(err, errMaskNotFound)
+			return updated, err
+		})
+		if err != nil {
+			status := workspaceErrorStatus(err)
+			switch {
+			case errors.Is(err, errMaskNotFound):
+				status = http.StatusNotFound
+			case invalid:
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, fmt.Sprintf("Failed to edit the mask of '%s'.'%s': %v", tableName, column, err), status)
+			return
+		}
+		log.Printf("maskingColumnHandler: %s the mask of '%s'.'%s' in %s", r.Method, tableName, column, filePath)
+
+		reloadSchemas(store)
+		if r.Method == http.MethodDelete {
+			w.Header().Set("ETag", contentETag(updated))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeColumnMask(w, ws, filePath, tableFolder, tableName, column, updated, status)
+	}
+}
+
+// writeColumnMask answers with the rule of a column read from the content of its masking file, and the ETag of that content.
+func writeColumnMask(w http.ResponseWriter, ws *Workspace, filePath, folderName, tableName, column string, content []byte, status int) {
+	mask, err := readColumnMask(content, column)
+	if err != nil {
+		status := http.StatusUnprocessableEntity
+		if errors.Is(err, errMaskNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	mask.Folder, mask.Table = folderName, tableName
+	mask.File, _ = ws.RelPath(filePath)
+
+	w.Header().Set("ETag", contentETag(content))
+	w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(mask); err != nil {
+		log.Printf("Failed to encode column mask to JSON: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// MaskingModel is the parsed masking file of a table, as served by /api/masking.
+type MaskingModel struct {
+	Table     string                     `json:"table"`
+	Version   string                     `json:"version"`
+	Seed      int                        `json:"seed"`
+	Caches    map[string]MaskingCache    `json:"caches"`
+	Functions map[string]MaskingFunction `json:"functions"`
+	Rules     []MaskingRuleModel         `json:"rules"`
+}
+
+// MaskingRuleModel is a rule of a masking file, its masks in PIMO form.
+type MaskingRuleModel struct {
+	Column   string                   `json:"column"`
+	Field    string                   `json:"field,omitempty"`    // JSON sub-field of the column, e.g. "city"
+	Masks    []map[string]interface{} `json:"masks"`              // e.g. [{"ff1": {"keyFromEnv": "KEY"}}]
+	Cache    string                   `json:"cache,omitempty"`    // Cache filled by the rule
+	Preserve string                   `json:"preserve,omitempty"` // e.g. "null"
+	Seed     interface{}              `json:"seed,omitempty"`     // Overrides the seed of the file
+}
+
+// CacheUsage lists the columns filling or reading a cache: they get the same masked value
+// for the same original value, across tables.
+type CacheUsage struct {
+	Name     string   `json:"name"`
+	Declared bool     `json:"declared"` // Declared under the caches of every masking file using it
+	Unique   bool     `json:"unique"`
+	Columns  []string `json:"columns"` // As "table.column"
+}
+
+// FolderMaskingModel is the masking model of the tables of a folder, with the caches they share.
+type FolderMaskingModel struct {
+	Folder string         `json:"folder"`
+	Tables []MaskingModel `json:"tables"`
+	Caches []CacheUsage   `json:"caches"`
+}
+
+// newMaskingModel converts the masking file of a table to its API form.
+func newMaskingModel(table string, schema MaskingSchema) MaskingModel {
+	model := MaskingModel{
+		Table:     table,
+		Version:   schema.Version,
+		Seed:      schema.Seed,
+		Caches:    schema.Caches,
+		Functions: schema.Functions,
+		Rules:     []MaskingRuleModel{},
+	}
+	if model.Caches == nil {
+		model.Caches = map[string]MaskingCache{}
+	}
+	if model.Functions == nil {
+		model.Functions = map[string]MaskingFunction{}
+	}
+	for _, rule := range schema.Masking {
+		column, field := rule.selector()
+		model.Rules = append(model.Rules, MaskingRuleModel{
+			Column:   column,
+			Field:    field,
+			Masks:    rule.pimoMasks(),
+			Cache:    rule.Cache,
+			Preserve: rule.Preserve,
+			Seed:     rule.Seed,
+		})
+	}
+	return model
+}
+
+// folderMaskingModel gathers the masking files of a folder and indexes the columns by cache.
+func folderMaskingModel(folderName string, folder *FolderData) FolderMaskingModel {
+	model := FolderMaskingModel{Folder: folderName, Tables: []MaskingModel{}, Caches: []CacheUsage{}}
+	tables := make([]string, 0, len(folder.Maskings))
+	for table := range folder.Maskings {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	usages := make(map[string]*CacheUsage)
+	for _, table := range tables {
+		schema := folder.Maskings[table]
+		model.Tables = append(model.Tables, newMaskingModel(table, schema))
+		for _, rule := range schema.Masking {
+			for _, cache := range rule.caches() {
+				usage, ok := usages[cache]
+				if !ok {
+					usage = &CacheUsage{Name: cache, Declared: true}
+					usages[cache] = usage
+				}
+				declared, ok := schema.Caches[cache]
+				usage.Declared = usage.Declared && ok
+				usage.Unique = usage.Unique || declared.Unique
+				usage.Columns = append(usage.Columns, table+"."+selectorPath(rule.selector()))
+			}
+		}
+	}
+	for _, usage := range usages {
+		model.Caches = append(model.Caches, *usage)
+	}
+	sort.Slice(model.Caches, func(i, j int) bool { return model.Caches[i].Name < model.Caches[j].Name })
+	return model
+}
+
+// maskingModelHandler serves the masking model of a folder, or of one of its tables when given.
+func maskingModelHandler(store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		tableName := chi.URLParam(r, "table")
+		snap := store.Snapshot()
+		folder, ok := snap.Data[folderName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("folder '%s' not found", folderName), http.StatusNotFound)
+			return
+		}
+
+		var model interface{} = folderMaskingModel(folderName, folder)
+		if tableName != "" {
+			schema, ok := folder.Maskings[tableName]
+			if !ok {
+				http.Error(w, fmt.Sprintf("table '%s' has no masking file in folder '%s'", tableName, folderName), http.StatusNotFound)
+				return
+			}
+			model = newMaskingModel(tableName, schema)
+		}
+		if checkNotModified(w, r, snap) {
+			return
+		}
+
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(model); err != nil {
+			log.Printf("Failed to encode masking model to JSON: %v", err)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MASK_REMOVED_FLAG starts the comment flagging the masking rules of columns which left their table.
+const MASK_REMOVED_FLAG = "# nino: column"
+
+// yamlDocument is a YAML file edited in place. Nodes are located with yaml.v3, but edits
+// splice whole lines of the original text instead of re-encoding the node tree: the encoder
+// moves or drops comments on empty values (like the boilerplate "mask:" followed by "# regex: \"\""),
+// and reformats quoting and indentation of lines nobody touched.
+type yamlDocument struct {
+	lines []string
+	crlf  bool       // The file uses Windows line endings
+	root  *yaml.Node // Top-level mapping of the document
+}
+
+// parseYAMLDocument parses a YAML file for in-place editing. An empty file gives an empty mapping.
+func parseYAMLDocument(content []byte) (*yamlDocument, error) {
+	doc := &yamlDocument{crlf: bytes.Contains(content, []byte("\r\n"))}
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text != "" {
+		doc.lines = strings.Split(text, "\n")
+	}
+	return doc, doc.parse()
+}
+
+// parse refreshes the node tree after the lines changed.
+func (doc *yamlDocument) parse() error {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(doc.lines, "\n")), &node); err != nil {
+		return err
+	}
+	switch {
+	case node.Kind == 0:
+		doc.root = &yaml.Node{Kind: yaml.MappingNode}
+	case len(node.Content) == 1 && node.Content[0].Kind == yaml.MappingNode:
+		doc.root = node.Content[0]
+	default:
+		return errors.New("the document is not a YAML mapping")
+	}
+	return nil
+}
+
+// bytes renders the document with its original line endings.
+func (doc *yamlDocument) bytes() []byte {
+	eol := "\n"
+	if doc.crlf {
+		eol = "\r\n"
+	}
+	if len(doc.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(doc.lines, eol) + eol)
+}
+
+// splice replaces count lines from index at (0-based) with the given lines, then re-parses the document.
+func (doc *yamlDocument) splice(at, count int, lines ...string) error {
+	updated := make([]string, 0, len(doc.lines)-count+len(lines))
+	updated = append(updated, doc.lines[:at]...)
+	updated = append(updated, lines...)
+	updated = append(updated, doc.lines[at+count:]...)
+	doc.lines = updated
+	return doc.parse()
+}
+
+// mappingEntry returns the key and value nodes of a key in a mapping node, or nils.
+func mappingEntry(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// mappingValue returns the value node of a key in a mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(mapping, key)
+	return value
+}
+
+// scalarValue returns the value of a scalar node, or "" for a missing node.
+func scalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// isBlockSequence tells whether a node is a non-empty block style sequence, whose items can be edited line by line.
+func isBlockSequence(node *yaml.Node) bool {
+	return node != nil && node.Kind == yaml.SequenceNode && len(node.Content) > 0 && node.Style&yaml.FlowStyle == 0
+}
+
+// indentOf returns the number of leading spaces of a line.
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// isBlankOrComment tells whether a line holds no YAML content.
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// dashIndent returns the indentation of the "- " of a block sequence item.
+func dashIndent(item *yaml.Node) int {
+	return item.Column - 1 - 2
+}
+
+// itemLines returns the range [start, end) of lines of the i-th item of a block sequence.
+// Comments at the indentation of the dashes, before the next item, belong to the next item.
+func (doc *yamlDocument) itemLines(seq *yaml.Node, i int) (int, int) {
+	item := seq.Content[i]
+	start, dash := item.Line-1, dashIndent(item)
+	last := i+1 == len(seq.Content)
+
+	limit := len(doc.lines)
+	if !last {
+		limit = seq.Content[i+1].Line - 1
+	}
+	end := start + 1
+scan:
+	for line := start + 1; line < limit; line++ {
+		text := doc.lines[line]
+		switch {
+		case strings.TrimSpace(text) == "":
+		case indentOf(text) > dash:
+			end = line + 1 // Content or comment of the item
+		case last && isBlankOrComment(text) && indentOf(text) == dash:
+			end = line + 1 // Closing comments of the sequence, e.g. a commented out rule
+		case last:
+			break scan // Next key of the parent mapping
+		}
+	}
+	return start, end
+}
+
+// entrySpan returns the range [start, end) of the lines of a mapping key and its value, within
+// the lines before limit. Comments indented under the key belong to it.
+func (doc *yamlDocument) entrySpan(key, value *yaml.Node, limit int) (int, int) {
+	start, end := key.Line-1, key.Line
+	for line := key.Line; line < limit; line++ {
+		text := doc.lines[line]
+		switch {
+		case strings.TrimSpace(text) == "":
+		case indentOf(text) > key.Column-1:
+			end = line + 1
+		case value.Kind == yaml.SequenceNode && indentOf(text) == key.Column-1 && strings.HasPrefix(strings.TrimSpace(text), "-"):
+			end = line + 1 // Sequence items at the indentation of their key
+		default:
+			return start, end
+		}
+	}
+	return start, end
+}
+
+// entryLines renders a "key: value" entry in block style, the key at the given indentation.
+func entryLines(indent int, key string, value interface{}) ([]string, error) {
+	if node, ok := value.(*yaml.Node); ok {
+		blockStyle(node)
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{key: value}); err != nil {
+		return nil, err
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		lines = append(lines, pad+line)
+	}
+	return lines, nil
+}
+
+// blockStyle turns the flow style collections of a node tree, e.g. decoded from JSON, into block style
+// with plain keys. String values keep their quotes.
+func blockStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style &^= yaml.FlowStyle
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			node.Content[i].Style = 0 // The encoder quotes the keys needing it
+		}
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// ruleColumnPath returns the normalized path selected by a masking rule, e.g. "address.city" for "$['address'].city".
+func ruleColumnPath(rule *yaml.Node) string {
+	return selectorPath(normalizeSelector(scalarValue(mappingValue(mappingValue(rule, "selector"), "jsonpath"))))
+}
+
+// maskingRuleIndex returns the index of the first rule selecting a column in the block sequence of masking rules, or -1.
+func maskingRuleIndex(seq *yaml.Node, column string) int {
+	if !isBlockSequence(seq) {
+		return -1
+	}
+	for i, item := range seq.Content {
+		if ruleColumnPath(item) == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendMaskingRules appends rules to the masking sequence, rendered with their dash at the given indentation.
+// A missing or empty "masking:" is turned into a block sequence.
+func (doc *yamlDocument) appendMaskingRules(render func(indent int) []string) error {
+	return doc.appendItems("masking", render)
+}
+
+// appendItems appends items to the sequence of a top-level key, rendered with their dash at the given indentation.
+// A missing or empty key is turned into a block sequence.
+func (doc *yamlDocument) appendItems(name string, render func(indent int) []string) error {
+	key, seq := mappingEntry(doc.root, name)
+	switch {
+	case seq == nil:
+		return doc.splice(len(doc.lines), 0, append([]string{name + ":"}, render(2)...)...)
+	case isBlockSequence(seq):
+		_, end := doc.itemLines(seq, len(seq.Content)-1)
+		return doc.splice(end, 0, render(dashIndent(seq.Content[0]))...)
+	case key.Column == 1 && len(seq.Content) == 0 && (seq.Kind == yaml.SequenceNode || seq.Tag == "!!null"):
+		// "masking:" or "masking: []": the key line is rewritten as a block sequence.
+		return doc.splice(key.Line-1, 1, append([]string{name + ":"}, render(2)...)...)
+	default:
+		return fmt.Errorf("'%s' is not a block sequence, it cannot be edited", name)
+	}
+}
+
+// MaskSyncReport describes what syncing a masking file with its table changed.
+type MaskSyncReport struct {
+	File     string   `json:"file"`
+	Created  bool     `json:"created"`  // The masking file did not exist yet
+	Added    []string `json:"added"`    // Columns which got a new masking rule
+	Removed  []string `json:"removed"`  // Masked columns no longer in the table, flagged with a comment
+	Restored []string `json:"restored"` // Flagged columns back in the table, whose flag was removed
+}
+
+// maskingRuleLines renders the boilerplate masking rule of a column, the dash at the given indentation.
+func maskingRuleLines(indent int, column string) []string {
+	pad := strings.Repeat(" ", indent)
+	return []string{
+		fmt.Sprintf("%s- selector:", pad),
+		fmt.Sprintf("%s    jsonpath: \"%s\"", pad, column),
+		fmt.Sprintf("%s  mask:", pad),
+		fmt.Sprintf("%s    # regex: \"\"", pad),
+	}
+}
+
+// newMaskingFile renders a boilerplate masking file with one rule per column.
+func newMaskingFile(table Table) []byte {
+	lines := []string{"version: \"1\"", "seed: 42", "masking:"}
+	for _, col := range table.Columns {
+		lines = append(lines, maskingRuleLines(2, col.Name)...)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// normalizeSelector splits a PIMO selector into the column it applies to and the path of the JSON
+// sub-field it masks, if any: "$.id" and "$['id']" give ("id", ""), "$.address.city" gives
+// ("address", "city") and "lines[*].sku" gives ("lines", "[*].sku").
+func normalizeSelector(jsonpath string) (column, field string) {
+	path := strings.TrimPrefix(strings.TrimSpace(jsonpath), "$")
+	var segments []string // Names, and array indexes like "[0]"
+	for path != "" {
+		switch {
+		case path[0] == '.':
+			path = path[1:]
+		case strings.HasPrefix(path, "['") || strings.HasPrefix(path, `["`):
+			end := strings.Index(path[2:], path[1:2]+"]")
+			if end < 0 {
+				segments, path = append(segments, path[2:]), ""
+				continue
+			}
+			segments, path = append(segments, path[2:2+end]), path[2+end+2:]
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				end = len(path) - 1
+			}
+			segments, path = append(segments, path[:end+1]), path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			segments, path = append(segments, path[:end]), path[end:]
+		}
+	}
+	if len(segments) == 0 {
+		return "", ""
+	}
+	var sb strings.Builder
+	for i, segment := range segments[1:] {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			sb.WriteString(".")
+		}
+		sb.WriteString(segment)
+	}
+	return segments[0], sb.String()
+}
+
+// selectorPath joins a column and the path of one of its sub-fields, the inverse of normalizeSelector.
+func selectorPath(column, field string) string {
+	if field == "" || strings.HasPrefix(field, "[") {
+		return column + field
+	}
+	return column + "." + field
+}
+
+// syncMaskingFile brings an existing masking file in line with the columns of its table:
+// rules are appended for new columns, and the rules of columns no longer in the table are
+// flagged with a comment (never deleted). Existing masks, comments and ordering are kept.
+func syncMaskingFile(content []byte, table Table) ([]byte, MaskSyncReport, error) {
+	report := MaskSyncReport{Added: []string{}, Removed: []string{}, Restored: []string{}}
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return nil, report, err
+	}
+
+	columns := make(map[string]bool, len(table.Columns))
+	for _, col := range table.Columns {
+		columns[col.Name] = true
+	}
+
+	// Flag or unflag the existing rules, from the bottom so that line numbers stay valid.
+	masked := make(map[string]bool)
+	seq := mappingValue(doc.root, "masking")
+	if isBlockSequence(seq) {
+		for i := len(seq.Content) - 1; i >= 0; i-- {
+			item := seq.Content[i]
+			column, _ := normalizeSelector(scalarValue(mappingValue(mappingValue(item, "selector"), "jsonpath")))
+			if column == "" {
+				continue
+			}
+			// A column masked by several rules is reported once, each of its rules being flagged.
+			reported := masked[column]
+			masked[column] = true
+
+			start := item.Line - 1
+			flagged := start > 0 && strings.HasPrefix(strings.TrimSpace(doc.lines[start-1]), MASK_REMOVED_FLAG)
+			switch {
+			case !columns[column] && !flagged:
+				flag := fmt.Sprintf("%s%s '%s' is not in table '%s' anymore", strings.Repeat(" ", dashIndent(item)), MASK_REMOVED_FLAG, column, table.Name)
+				err = doc.splice(start, 0, flag)
+				if !reported {
+					report.Removed = append(report.Removed, column)
+				}
+			case !columns[column]:
+				if !reported {
+					report.Removed = append(report.Removed, column)
+				}
+			case flagged:
+				err = doc.splice(start-1, 1)
+				if !reported {
+					report.Restored = append(report.Restored, column)
+				}
+			}
+			if err != nil {
+				return nil, report, err
+			}
+			seq = mappingValue(doc.root, "masking")
+		}
+	}
+
+	slices.Reverse(report.Removed) // Back in the order of the file
+	slices.Reverse(report.Restored)
+
+	// Append the rules of the new columns, in the order of the table.
+	for _, col := range table.Columns {
+		if !masked[col.Name] {
+			report.Added = append(report.Added, col.Name)
+		}
+	}
+	if len(report.Added) == 0 {
+		return doc.bytes(), report, nil
+	}
+	err = doc.appendMaskingRules(func(indent int) []string {
+		var rules []string
+		for _, column := range report.Added {
+			rules = append(rules, maskingRuleLines(indent, column)...)
+		}
+		return rules
+	})
+	if err != nil {
+		return nil, report, err
+	}
+	return doc.bytes(), report, nil
+}
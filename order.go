@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// OrderedTable is a table of a folder, ranked by the order it can be loaded in.
+type OrderedTable struct {
+	Name          string   `json:"name"`
+	Rank          int      `json:"rank"`                    // 1 without parents, one more than its highest ranked parent otherwise
+	Parents       []string `json:"parents"`                 // Tables it references, itself excluded
+	Cycle         int      `json:"cycle,omitempty"`         // Number of its cycle in LoadOrder.Cycles, from 1, 0 when in none
+	SelfReference bool     `json:"selfReference,omitempty"` // It references itself
+}
+
+// LoadCycle is a set of tables referencing each other, which cannot be loaded parents first:
+// lino push needs one of their relations to be loaded in a second pass, or the constraints deferred.
+type LoadCycle struct {
+	Tables    []string `json:"tables"`
+	Relations []string `json:"relations"`
+}
+
+// LoadOrder is the order in which the tables of a folder can be pushed, parents first.
+// Tables of a cycle share the same rank, after all their parents out of the cycle.
+type LoadOrder struct {
+	Folder         string         `json:"folder"`
+	Tables         []OrderedTable `json:"tables"`
+	Cycles         []LoadCycle    `json:"cycles"`
+	SelfReferences []string       `json:"selfReferences"` // Relations of a table to itself
+	Warnings       []string       `json:"warnings,omitempty"`
+}
+
+// loadOrder ranks the tables of a folder from its relations. The strongly connected components of the
+// relation graph are found first (Tarjan), so that tables referencing each other are ranked together
+// and reported as a cycle, then the components are ranked parents first.
+func loadOrder(folderName string, folder *FolderData) LoadOrder {
+	order := LoadOrder{Folder: folderName, Tables: []OrderedTable{}, Cycles: []LoadCycle{}, SelfReferences: []string{}}
+	index := map[string]int{}
+	for _, table := range folder.Tables {
+		if _, seen := index[table.Name]; !seen {
+			index[table.Name] = len(order.Tables)
+			order.Tables = append(order.Tables, OrderedTable{Name: table.Name, Parents: []string{}})
+		}
+	}
+
+	type edge struct {
+		parent, child int
+		relation      string
+	}
+	edges := []edge{}
+	children := make([][]int, len(order.Tables))
+	for _, relation := range folder.Relations.Relations {
+		parent, parentFound := index[relation.Parent.Name]
+		child, childFound := index[relation.Child.Name]
+		switch {
+		case !parentFound || !childFound:
+			order.Warnings = append(order.Warnings, fmt.Sprintf("relation '%s' links tables '%s' and '%s' which are not all in the folder", relation.Name, relation.Parent.Name, relation.Child.Name))
+			continue
+		case parent == child:
+			order.SelfReferences = append(order.SelfReferences, relation.Name)
+			order.Tables[child].SelfReference = true
+			continue
+		}
+		edges = append(edges, edge{parent, child, relation.Name})
+		if !slices.Contains(children[parent], child) {
+			children[parent] = append(children[parent], child)
+			order.Tables[child].Parents = append(order.Tables[child].Parents, relation.Parent.Name)
+		}
+	}
+
+	// Tarjan's algorithm gives the components children first.
+	component := make([]int, len(order.Tables))
+	components := [][]int{}
+	indices, lowLinks := make([]int, len(order.Tables)), make([]int, len(order.Tables))
+	onStack := make([]bool, len(order.Tables))
+	stack := []int{}
+	next := 1
+	var connect func(v int)
+	connect = func(v int) {
+		indices[v], lowLinks[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range children[v] {
+			if indices[w] == 0 {
+				connect(w)
+				lowLinks[v] = min(lowLinks[v], lowLinks[w])
+			} else if onStack[w] {
+				lowLinks[v] = min(lowLinks[v], indices[w])
+			}
+		}
+		if lowLinks[v] == indices[v] {
+			members := []int{}
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component[w] = len(components)
+				members = append(members, w)
+				if w == v {
+					break
+				}
+			}
+			components = append(components, members)
+		}
+	}
+	for v := range order.Tables {
+		if indices[v] == 0 {
+			connect(v)
+		}
+	}
+
+	// Ranking the components parents first, from the last found to the first.
+	ranks := make([]int, len(components))
+	for c := len(components) - 1; c >= 0; c-- {
+		if ranks[c] == 0 {
+			ranks[c] = 1
+		}
+		for _, v := range components[c] {
+			for _, w := range children[v] {
+				if component[w] != c {
+					ranks[component[w]] = max(ranks[component[w]], ranks[c]+1)
+				}
+			}
+		}
+	}
+	for v := range order.Tables {
+		order.Tables[v].Rank = ranks[component[v]]
+	}
+
+	// Cycles are numbered in the order of their first table.
+	cycles := map[int]int{}
+	for v := range order.Tables {
+		c := component[v]
+		if len(components[c]) < 2 {
+			continue
+		}
+		if _, seen := cycles[c]; !seen {
+			cycles[c] = len(order.Cycles) + 1
+			order.Cycles = append(order.Cycles, LoadCycle{Tables: []string{}, Relations: []string{}})
+		}
+		order.Tables[v].Cycle = cycles[c]
+		order.Cycles[cycles[c]-1].Tables = append(order.Cycles[cycles[c]-1].Tables, order.Tables[v].Name)
+	}
+	for _, e := range edges {
+		if c := component[e.parent]; component[e.child] == c && len(components[c]) > 1 {
+			order.Cycles[cycles[c]-1].Relations = append(order.Cycles[cycles[c]-1].Relations, e.relation)
+		}
+	}
+
+	sort.SliceStable(order.Tables, func(i, j int) bool { return order.Tables[i].Rank < order.Tables[j].Rank })
+	return order
+}
+
+// printLoadOrder writes the load order of a folder as text: one table per line with its rank, then its cycles.
+func printLoadOrder(order LoadOrder) {
+	fmt.Printf("# %s\n", order.Folder)
+	for _, table := range order.Tables {
+		var notes []string
+		if table.Cycle > 0 {
+			notes = append(notes, fmt.Sprintf("cycle %d", table.Cycle))
+		}
+		if table.SelfReference {
+			notes = append(notes, "self-reference")
+		}
+		line := fmt.Sprintf("%4d  %s", table.Rank, table.Name)
+		if len(notes) > 0 {
+			line += fmt.Sprintf("  (%s)", strings.Join(notes, ", "))
+		}
+		fmt.Println(line)
+	}
+	for i, cycle := range order.Cycles {
+		fmt.Printf("cycle %d: %s, through %s\n", i+1, strings.Join(cycle.Tables, ", "), strings.Join(cycle.Relations, ", "))
+	}
+	if len(order.SelfReferences) > 0 {
+		fmt.Printf("self-references: %s\n", strings.Join(order.SelfReferences, ", "))
+	}
+	for _, warning := range order.Warnings {
+		log.Printf("Warning: %s: %s", order.Folder, warning)
+	}
+}
+
+// orderCommand runs `nino order`, printing the tables of the folders in the order lino push loads them.
+func orderCommand(args []string) error {
+	flags := flag.NewFlagSet("order", flag.ExitOnError)
+	folderName := flags.String("f", "", "Only print the order of this folder.")
+	asJSON := flags.Bool("json", false, "Print the orders as JSON, like /api/order.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s order [-f folder] [-json] <file/folder paths...>\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Prints the tables of each folder parents first, from their relations, with the cycles and self-references of the relations.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing file or folder paths")
+	}
+
+	fileMap, err := findSchemaFiles(flags.Args())
+	if err != nil {
+		return err
+	}
+	projectData, err := inferAllSchemas(fileMap)
+	if err != nil {
+		return err
+	}
+	folders := []string{}
+	for name := range projectData {
+		if *folderName == "" || name == *folderName {
+			folders = append(folders, name)
+		}
+	}
+	if len(folders) == 0 {
+		return fmt.Errorf("folder '%s' not found", *folderName)
+	}
+	sort.Strings(folders)
+
+	orders := []LoadOrder{}
+	for _, name := range folders {
+		orders = append(orders, loadOrder(name, projectData[name]))
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(orders)
+	}
+	for i, order := range orders {
+		if i > 0 {
+			fmt.Println()
+		}
+		printLoadOrder(order)
+	}
+	return nil
+}
+
+// loadOrderHandler returns the load order of the tables of a folder.
+func loadOrderHandler(store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		snap := store.Snapshot()
+		if checkNotModified(w, r, snap) {
+			return
+		}
+		folder, ok := snap.Data[folderName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("folder '%s' not found", folderName), http.StatusNotFound)
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(loadOrder(folderName, folder)); err != nil {
+			log.Printf("Failed to encode load order to JSON: %v", err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// orderFolder builds the data of a folder from its table names and relations, given as {name, parent, child}.
+func orderFolder(tables []string, relations [][3]string) *FolderData {
+	folder := &FolderData{}
+	for _, name := range tables {
+		folder.Tables = append(folder.Tables, Table{Name: name, Keys: []string{"id"}})
+	}
+	for _, relation := range relations {
+		folder.Relations.Relations = append(folder.Relations.Relations, Relation{
+			Name:   relation[0],
+			Parent: Table{Name: relation[1], Keys: []string{"id"}},
+			Child:  Table{Name: relation[2], Keys: []string{relation[1] + "_id"}},
+		})
+	}
+	return folder
+}
+
+func TestLoadOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		tables    []string
+		relations [][3]string
+		want      LoadOrder
+	}{
+		{
+			name:      "chain",
+			tables:    []string{"visits", "pets", "owners"},
+			relations: [][3]string{{"pets_owners", "owners", "pets"}, {"visits_pets", "pets", "visits"}},
+			want: LoadOrder{
+				Tables: []OrderedTable{
+					{Name: "owners", Rank: 1, Parents: []string{}},
+					{Name: "pets", Rank: 2, Parents: []string{"owners"}},
+					{Name: "visits", Rank: 3, Parents: []string{"pets"}},
+				},
+				Cycles:         []LoadCycle{},
+				SelfReferences: []string{},
+			},
+		},
+		{
+			name:   "cycle with an outside parent",
+			tables: []string{"a", "b", "c", "d"},
+			relations: [][3]string{
+				{"b_a", "a", "b"},
+				{"c_b", "b", "c"},
+				{"b_c", "c", "b"},
+				{"d_c", "c", "d"},
+			},
+			want: LoadOrder{
+				Tables: []OrderedTable{
+					{Name: "a", Rank: 1, Parents: []string{}},
+					{Name: "b", Rank: 2, Parents: []string{"a", "c"}, Cycle: 1},
+					{Name: "c", Rank: 2, Parents: []string{"b"}, Cycle: 1},
+					{Name: "d", Rank: 3, Parents: []string{"c"}},
+				},
+				Cycles:         []LoadCycle{{Tables: []string{"b", "c"}, Relations: []string{"c_b", "b_c"}}},
+				SelfReferences: []string{},
+			},
+		},
+		{
+			name:      "self-reference",
+			tables:    []string{"employees", "departments"},
+			relations: [][3]string{{"employees_manager", "employees", "employees"}, {"employees_departments", "departments", "employees"}},
+			want: LoadOrder{
+				Tables: []OrderedTable{
+					{Name: "departments", Rank: 1, Parents: []string{}},
+					{Name: "employees", Rank: 2, Parents: []string{"departments"}, SelfReference: true},
+				},
+				Cycles:         []LoadCycle{},
+				SelfReferences: []string{"employees_manager"},
+			},
+		},
+		{
+			name:      "relation to a table out of the folder",
+			tables:    []string{"pets"},
+			relations: [][3]string{{"pets_owners", "owners", "pets"}},
+			want: LoadOrder{
+				Tables:         []OrderedTable{{Name: "pets", Rank: 1, Parents: []string{}}},
+				Cycles:         []LoadCycle{},
+				SelfReferences: []string{},
+				Warnings:       []string{"relation 'pets_owners' links tables 'owners' and 'pets' which are not all in the folder"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.want.Folder = "folder"
+			if got := loadOrder("folder", orderFolder(test.tables, test.relations)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\n got %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -70,23 +71,107 @@ type MaskingRule struct {
 			Start     int `yaml:"start"`
 			Increment int `yaml:"increment"`
 		} `yaml:"incremental"`
+		Others map[string]interface{} `yaml:",inline"` // Any other PIMO mask, e.g. ff1
 	} `yaml:"mask"`
 	Masks []struct { // For the 'masks' field which is a list of masks
-		AddTransient      string `yaml:"add-transient"`
-		RandomChoiceInUri string `yaml:"randomChoiceInUri"`
-		Template          string `yaml:"template"`
+		AddTransient      string                 `yaml:"add-transient"`
+		RandomChoiceInUri string                 `yaml:"randomChoiceInUri"`
+		Template          string                 `yaml:"template"`
+		Others            map[string]interface{} `yaml:",inline"`
 	} `yaml:"masks"`
+	Cache    string      `yaml:"cache"`    // Cache giving the same masked value to the same original value
+	Preserve string      `yaml:"preserve"` // Values left as is: null, empty, blank, notInCache
+	Seed     interface{} `yaml:"seed"`     // Overrides the seed of the file for this rule
+}
+
+// MaskingCache declares a cache of a masking file.
+type MaskingCache struct {
+	Unique  bool `yaml:"unique" json:"unique"`   // Never gives the same masked value to two original values
+	Reverse bool `yaml:"reverse" json:"reverse"` // Maps the masked values back to the original ones
+}
+
+// MaskingFunction declares a function of a masking file, callable from templates and other masks.
+type MaskingFunction struct {
+	Params []struct {
+		Name string `yaml:"name" json:"name"`
+	} `yaml:"params" json:"params"`
+	Body string `yaml:"body" json:"body"`
+}
+
+// selector returns the column selected by a rule, and the path of the JSON sub-field it masks, if any.
+func (rule MaskingRule) selector() (column, field string) {
+	return normalizeSelector(rule.Selector.Jsonpath)
+}
+
+// caches returns the caches a rule fills or reads, with its cache option or fromCache masks.
+func (rule MaskingRule) caches() []string {
+	caches := []string{}
+	if rule.Cache != "" {
+		caches = append(caches, rule.Cache)
+	}
+	for _, mask := range rule.pimoMasks() {
+		if name, ok := mask["fromCache"].(string); ok && name != "" && !slices.Contains(caches, name) {
+			caches = append(caches, name)
+		}
+	}
+	return caches
+}
+
+// pimoMasks returns the masks of a rule as generic PIMO masks, in the order they apply.
+// The boilerplate rule with an empty mask has none.
+func (rule MaskingRule) pimoMasks() []map[string]interface{} {
+	masks := []map[string]interface{}{}
+	mask := make(map[string]interface{})
+	for kind, args := range rule.Mask.Others {
+		mask[kind] = args
+	}
+	if rule.Mask.Regex != "" {
+		mask["regex"] = rule.Mask.Regex
+	}
+	if rule.Mask.RandomChoiceInUri != "" {
+		mask["randomChoiceInUri"] = rule.Mask.RandomChoiceInUri
+	}
+	if incremental := rule.Mask.Incremental; incremental.Start != 0 || incremental.Increment != 0 {
+		mask["incremental"] = map[string]interface{}{"start": incremental.Start, "increment": incremental.Increment}
+	}
+	if len(mask) > 0 {
+		masks = append(masks, mask)
+	}
+
+	for _, item := range rule.Masks {
+		mask := make(map[string]interface{})
+		for kind, args := range item.Others {
+			mask[kind] = args
+		}
+		if item.AddTransient != "" {
+			mask["add-transient"] = item.AddTransient
+		}
+		if item.RandomChoiceInUri != "" {
+			mask["randomChoiceInUri"] = item.RandomChoiceInUri
+		}
+		if item.Template != "" {
+			mask["template"] = item.Template
+		}
+		if len(mask) > 0 {
+			masks = append(masks, mask)
+		}
+	}
+	return masks
 }
 
 // MaskingSchema holds the data from an masking.yaml file (now masking rules).
 type MaskingSchema struct {
-	Version string        `yaml:"version"`
-	Seed    int           `yaml:"seed"`
-	Masking []MaskingRule `yaml:"masking"`
+	Version   string                     `yaml:"version"`
+	Seed      int                        `yaml:"seed"`
+	Functions map[string]MaskingFunction `yaml:"functions"`
+	Caches    map[string]MaskingCache    `yaml:"caches"`
+	Masking   []MaskingRule              `yaml:"masking"`
 }
 
 // StringMetric holds detailed metrics for string type columns.
 type StringMetric struct {
+	MinLen  int `yaml:"minLen"`
+	MaxLen  int `yaml:"maxLen"`
 	Lengths []struct {
 		Length int     `yaml:"length"`
 		Freq   float64 `yaml:"freq"`
@@ -101,9 +186,14 @@ type NumericMetric struct {
 // AnalyzeColumn holds metric data for a single column from analyze.yaml.
 type AnalyzeColumn struct {
 	Name       string `yaml:"name"`
+	Type       string `yaml:"type"` // string, numeric or bool
 	MainMetric struct {
-		Count int         `yaml:"count"`
-		Min   interface{} `yaml:"min"`
+		Count   int           `yaml:"count"`
+		Empty   int           `yaml:"empty"`
+		Nulls   int           `yaml:"nulls"`
+		Min     interface{}   `yaml:"min"`
+		Max     interface{}   `yaml:"max"`
+		Samples []interface{} `yaml:"samples"`
 	} `yaml:"mainMetric"`
 	StringMetric  StringMetric  `yaml:"stringMetric"`
 	NumericMetric NumericMetric `yaml:"numericMetric"`
@@ -125,7 +215,7 @@ type AnalyzeSchema struct {
 }
 
 // maskInfo holds the extracted details of a masking rule for easy use.
-type maskInfo struct{ maskType, maskValue string }
+type maskInfo struct{ field, maskType, maskValue string }
 
 // FolderData holds all schemas for a single folder.
 type FolderData struct {
@@ -174,120 +264,254 @@ type ProjectData map[string]*FolderData
 
 // inferAllSchemas parses all primary, masking, and analysis YAML files.
 func inferAllSchemas(fileMap map[string]string) (ProjectData, error) {
-	projectData := make(ProjectData)
-
-	for file, basePath := range fileMap {
-		baseName := filepath.Base(file)
-		dir := filepath.Dir(file)
-		var relPath string
-
-		// Determine the relative path to use as the folder/cluster key.
-		// If the file's directory is the same as the base path provided during startup,
-		// the folder key should be the name of that base directory itself.
-		if filepath.Clean(dir) == filepath.Clean(basePath) {
-			relPath = filepath.Base(basePath)
-		} else {
-			// Otherwise, it's in a subdirectory. We take the first-level directory name.
-			relPath = strings.Split(strings.TrimPrefix(dir, basePath+string(os.PathSeparator)), string(os.PathSeparator))[0]
-		}
-		log.Printf("File: %s, BasePath: %s, RelPath: %s", file, basePath, relPath)
-
-		// Ensure a FolderData struct exists for the current path.
-		if _, ok := projectData[relPath]; !ok {
-			projectData[relPath] = &FolderData{
-				Maskings: make(map[string]MaskingSchema),
-			}
-		}
-		folder := projectData[relPath]
-
-		// Route file parsing based on filename.
-		switch {
-		case baseName == "relations.yaml":
-			parseRelations(file, folder)
-		case baseName == "dataconnector.yaml":
-			parseDataConnector(file, folder)
-		case baseName == "analyze.yaml":
-			parseAnalyze(file, folder)
-		case strings.HasSuffix(baseName, "-masking.yaml"):
-			parseMasking(file, folder)
-		case baseName == "target-tables.yaml":
-			parseTargetTables(file, folder)
-		case baseName == "target-analyze.yaml":
-			parseTargetAnalyze(file, folder)
-		case baseName == "playbook.yaml":
-			parsePlaybook(file, folder)
-		default:
-			// Assume any other .yaml file contains table definitions.
-			parseTables(file, folder)
-		}
-	}
-
+	projectData, _ := newSchemaCache().update(fileMap, nil)
 	return projectData, nil
 }
 
-// Helper functions to parse specific YAML file types.
+// Kinds of YAML files, detected from their name.
+const (
+	KIND_RELATIONS      = "relations"
+	KIND_DATACONNECTOR  = "dataconnector"
+	KIND_ANALYZE        = "analyze"
+	KIND_MASKING        = "masking"
+	KIND_TARGET_TABLES  = "target-tables"
+	KIND_TARGET_ANALYZE = "target-analyze"
+	KIND_PLAYBOOK       = "playbook"
+	KIND_TABLES         = "tables"
+	KIND_SQLITE         = "sqlite"
+)
 
-func parseRelations(file string, folder *FolderData) {
-	var relSchema RelationSchema
-	if err := parseYAMLFile(file, &relSchema); err == nil {
-		folder.Relations = relSchema
+// schemaKind routes file parsing based on filename.
+func schemaKind(file string) string {
+	baseName := filepath.Base(file)
+	switch {
+	case baseName == "relations.yaml":
+		return KIND_RELATIONS
+	case baseName == "dataconnector.yaml":
+		return KIND_DATACONNECTOR
+	case baseName == "analyze.yaml":
+		return KIND_ANALYZE
+	case strings.HasSuffix(baseName, "-masking.yaml"):
+		return KIND_MASKING
+	case baseName == "target-tables.yaml":
+		return KIND_TARGET_TABLES
+	case baseName == "target-analyze.yaml":
+		return KIND_TARGET_ANALYZE
+	case baseName == "playbook.yaml":
+		return KIND_PLAYBOOK
+	case hasSQLiteSuffix(baseName):
+		return KIND_SQLITE
+	default:
+		// Assume any other .yaml file contains table definitions.
+		return KIND_TABLES
 	}
 }
 
-func parseDataConnector(file string, folder *FolderData) {
-	var dcSchema DataConnectorSchema
-	if err := parseYAMLFile(file, &dcSchema); err == nil {
-		folder.DataConnectors = dcSchema
+// folderKey determines the relative path to use as the folder/cluster key of a file.
+func folderKey(file, basePath string) string {
+	dir := filepath.Dir(file)
+	// If the file's directory is the same as the base path provided during startup,
+	// the folder key should be the name of that base directory itself.
+	if filepath.Clean(dir) == filepath.Clean(basePath) {
+		return filepath.Base(basePath)
 	}
+	// Otherwise, it's in a subdirectory. We take the first-level directory name.
+	return strings.Split(strings.TrimPrefix(dir, basePath+string(os.PathSeparator)), string(os.PathSeparator))[0]
 }
 
-func parseAnalyze(file string, folder *FolderData) {
-	var analysisSchema AnalyzeSchema
-	if err := parseYAMLFile(file, &analysisSchema); err == nil {
-		folder.Analysis = analysisSchema
+// folderDir returns the directory of the folder of a file, the one whose name folderKey returns.
+func folderDir(file, basePath string) string {
+	key := folderKey(file, basePath)
+	if key == filepath.Base(basePath) {
+		return basePath
 	}
+	return filepath.Join(basePath, key)
 }
 
-func parseMasking(file string, folder *FolderData) {
-	var desc MaskingSchema
-	if err := parseYAMLFile(file, &desc); err == nil {
-		tableName := strings.TrimSuffix(filepath.Base(file), "-masking.yaml")
-		folder.Maskings[tableName] = desc
+// decodeSchema unmarshals the content of a file into the structure matching its kind.
+func decodeSchema(file, kind string, content []byte) (interface{}, error) {
+	var out interface{}
+	switch kind {
+	case KIND_SQLITE:
+		return readSQLite(file, content)
+	case KIND_RELATIONS:
+		out = &RelationSchema{}
+	case KIND_DATACONNECTOR:
+		out = &DataConnectorSchema{}
+	case KIND_ANALYZE, KIND_TARGET_ANALYZE:
+		out = &AnalyzeSchema{}
+	case KIND_MASKING:
+		out = &MaskingSchema{}
+	case KIND_PLAYBOOK:
+		out = &AnsiblePlaybook{}
+	default:
+		out = &TableSchema{}
 	}
-}
-
-func parseTargetTables(file string, folder *FolderData) {
-	var tableSchema TableSchema
-	if err := parseYAMLFile(file, &tableSchema); err == nil {
-		folder.TargetTables = append(folder.TargetTables, tableSchema.Tables...)
+	if err := parseYAMLBytes(file, content, out); err != nil {
+		return nil, err
 	}
+	return out, nil
 }
 
-func parseTargetAnalyze(file string, folder *FolderData) {
-	var analysisSchema AnalyzeSchema
-	if err := parseYAMLFile(file, &analysisSchema); err == nil {
-		folder.TargetAnalysis = analysisSchema
+// applySchema merges a decoded file into the data of its folder.
+func applySchema(folder *FolderData, file, kind string, value interface{}) {
+	switch kind {
+	case KIND_RELATIONS:
+		folder.Relations = *value.(*RelationSchema)
+	case KIND_DATACONNECTOR:
+		folder.DataConnectors = *value.(*DataConnectorSchema)
+	case KIND_ANALYZE:
+		folder.Analysis = *value.(*AnalyzeSchema)
+	case KIND_MASKING:
+		tableName := strings.TrimSuffix(filepath.Base(file), "-masking.yaml")
+		folder.Maskings[tableName] = *value.(*MaskingSchema)
+	case KIND_TARGET_TABLES:
+		folder.TargetTables = append(folder.TargetTables, value.(*TableSchema).Tables...)
+	case KIND_TARGET_ANALYZE:
+		folder.TargetAnalysis = *value.(*AnalyzeSchema)
+	case KIND_PLAYBOOK:
+		folder.Playbook = *value.(*AnsiblePlaybook)
+	case KIND_SQLITE:
+		// Databases are merged after the YAML files, which take precedence: the tables, relations and
+		// metrics already there, e.g. from the tables.yaml generated by import-ddl, are not added twice.
+		database := value.(*SQLiteSchema)
+		names := make(map[string]bool)
+		for _, table := range folder.Tables {
+			names[table.Name] = true
+		}
+		for _, table := range database.Tables {
+			if !names[table.Name] {
+				folder.Tables = append(folder.Tables, table)
+				names[table.Name] = true
+			}
+		}
+		if folder.Relations.Version == "" {
+			folder.Relations.Version = database.Relations.Version
+		}
+		names = make(map[string]bool)
+		for _, relation := range folder.Relations.Relations {
+			names[relation.Name] = true
+		}
+		for _, relation := range database.Relations.Relations {
+			if !names[relation.Name] {
+				folder.Relations.Relations = append(folder.Relations.Relations, relation)
+				names[relation.Name] = true
+			}
+		}
+		if folder.Analysis.Database == "" {
+			folder.Analysis.Database = database.Analysis.Database
+		}
+		names = make(map[string]bool)
+		for _, table := range folder.Analysis.Tables {
+			names[table.Name] = true
+		}
+		for _, table := range database.Analysis.Tables {
+			if !names[table.Name] {
+				folder.Analysis.Tables = append(folder.Analysis.Tables, table)
+				names[table.Name] = true
+			}
+		}
+	default:
+		folder.Tables = append(folder.Tables, value.(*TableSchema).Tables...)
 	}
 }
 
-func parsePlaybook(file string, folder *FolderData) {
-	var playbook AnsiblePlaybook
-	if err := parseYAMLFile(file, &playbook); err == nil {
-		folder.Playbook = playbook
+// validateSchema checks a decoded file for the mistakes lino and pimo would reject or silently ignore,
+// and returns one message per problem found.
+func validateSchema(kind string, value interface{}) []string {
+	problems := []string{}
+	switch kind {
+	case KIND_RELATIONS:
+		for i, relation := range value.(*RelationSchema).Relations {
+			if relation.Name == "" {
+				problems = append(problems, fmt.Sprintf("relations[%d]: missing name", i))
+			}
+			if relation.Parent.Name == "" {
+				problems = append(problems, fmt.Sprintf("relations[%d]: missing parent table", i))
+			}
+			if relation.Child.Name == "" {
+				problems = append(problems, fmt.Sprintf("relations[%d]: missing child table", i))
+			}
+		}
+	case KIND_DATACONNECTOR:
+		for i, connector := range value.(*DataConnectorSchema).DataConnectors {
+			if connector.Name == "" {
+				problems = append(problems, fmt.Sprintf("dataconnectors[%d]: missing name", i))
+			}
+			if connector.URL == "" {
+				problems = append(problems, fmt.Sprintf("dataconnectors[%d]: missing url", i))
+			}
+		}
+	case KIND_SQLITE:
+		problems = append(problems, value.(*SQLiteSchema).Warnings...)
+	case KIND_ANALYZE, KIND_TARGET_ANALYZE:
+		for i, table := range value.(*AnalyzeSchema).Tables {
+			if table.Name == "" {
+				problems = append(problems, fmt.Sprintf("tables[%d]: missing name", i))
+			}
+		}
+	case KIND_MASKING:
+		seen := make(map[string]bool)
+		schema := value.(*MaskingSchema)
+		for i, rule := range schema.Masking {
+			jsonpath := rule.Selector.Jsonpath
+			path := selectorPath(rule.selector()) // "$.id" and "id" select the same column
+			if jsonpath == "" {
+				problems = append(problems, fmt.Sprintf("masking[%d]: missing selector jsonpath", i))
+			} else if seen[path] {
+				problems = append(problems, fmt.Sprintf("masking[%d]: jsonpath '%s' is already masked", i, jsonpath))
+			}
+			seen[path] = true
+			for _, cache := range rule.caches() {
+				if _, ok := schema.Caches[cache]; !ok {
+					problems = append(problems, fmt.Sprintf("masking[%d]: cache '%s' is not declared under caches", i, cache))
+				}
+			}
+		}
+	case KIND_PLAYBOOK:
+		for i, play := range *value.(*AnsiblePlaybook) {
+			if play.Hosts == "" {
+				problems = append(problems, fmt.Sprintf("play[%d]: missing hosts", i))
+			}
+		}
+	default:
+		seen := make(map[string]bool)
+		for i, table := range value.(*TableSchema).Tables {
+			if table.Name == "" {
+				problems = append(problems, fmt.Sprintf("tables[%d]: missing name", i))
+			} else if seen[table.Name] {
+				problems = append(problems, fmt.Sprintf("tables[%d]: table '%s' is declared twice", i, table.Name))
+			}
+			seen[table.Name] = true
+		}
 	}
+	return problems
 }
 
-func parseTables(file string, folder *FolderData) {
-	var tableSchema TableSchema
-	if err := parseYAMLFile(file, &tableSchema); err == nil {
-		folder.Tables = append(folder.Tables, tableSchema.Tables...)
+// findSchemaFiles recursively searches input paths for the files nino reads: YAML files and SQLite databases.
+// Files named like a database but which are not SQLite databases are left out.
+func findSchemaFiles(paths []string) (map[string]string, error) {
+	fileMap, err := findFiles(paths, append([]string{".yaml", ".yml"}, SQLITE_SUFFIXES...)...)
+	if err != nil {
+		return nil, err
+	}
+	for file := range fileMap {
+		if hasSQLiteSuffix(file) && !isSQLiteFile(file) {
+			delete(fileMap, file)
+		}
 	}
+	return fileMap, nil
 }
 
-// findYAMLFiles recursively searches input paths for .yaml and .yml files.
-func findYAMLFiles(paths []string) (map[string]string, error) {
+// findFiles recursively searches input paths for files with one of the suffixes,
+// and maps them onto the input path they were found in.
+func findFiles(paths []string, suffixes ...string) (map[string]string, error) {
+	matches := func(path string) bool {
+		return slices.ContainsFunc(suffixes, func(suffix string) bool { return strings.HasSuffix(path, suffix) })
+	}
 	skippedFolders := map[string]bool{
 		".devcontainer": true,
+		".nino":         true,
 		".github":       true,
 		"doc":           true,
 		"node_modules":  true,
@@ -304,7 +528,7 @@ func findYAMLFiles(paths []string) (map[string]string, error) {
 
 		basePath := path
 		if !info.IsDir() {
-			if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+			if matches(path) {
 				fileMap[path] = filepath.Dir(path) // For single files, the base is their own dir.
 			}
 			continue
@@ -319,7 +543,7 @@ func findYAMLFiles(paths []string) (map[string]string, error) {
 			if d.IsDir() && skippedFolders[d.Name()] {
 				return filepath.SkipDir
 			}
-			if !d.IsDir() && (strings.HasSuffix(p, ".yaml") || strings.HasSuffix(p, ".yml")) {
+			if !d.IsDir() && matches(p) {
 				fileMap[p] = basePath
 			}
 			return nil
@@ -337,6 +561,11 @@ func parseYAMLFile(filename string, out interface{}) error {
 	if err != nil {
 		return err
 	}
+	return parseYAMLBytes(filename, bytes, out)
+}
+
+// parseYAMLBytes unmarshals the already read content of a YAML file into a given struct.
+func parseYAMLBytes(filename string, bytes []byte, out interface{}) error {
 	if err := yaml.Unmarshal(bytes, out); err != nil {
 		log.Printf("Warning: Could not parse YAML file %s: %v", filename, err)
 		return err
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Problems of a field found by the masking check.
+const (
+	CHECK_UNSTABLE     = "unstable"     // Masked differently by two runs, despite the fixed seed of the masking file
+	CHECK_LEAK         = "leak"         // Masked, but every value is kept unchanged
+	CHECK_PARTIAL_LEAK = "partial-leak" // Masked, but some values are kept unchanged
+)
+
+// FieldCheck is the result of the masking check for a field of the sample rows.
+type FieldCheck struct {
+	Field    string   `json:"field"`    // Path of the field, e.g. "address.city"
+	Masked   bool     `json:"masked"`   // A rule of the masking file masks the field
+	Values   int      `json:"values"`   // Rows where the field has a value, neither null nor empty
+	Unstable int      `json:"unstable"` // Rows masked differently by the two runs
+	Leaks    int      `json:"leaks"`    // Rows where the masked value is the original value
+	Problems []string `json:"problems"` // See CHECK_*
+}
+
+// MaskingCheckReport tells whether a masking file is deterministic and actually alters the data it masks.
+type MaskingCheckReport struct {
+	Success   bool            `json:"success"`   // Both pimo runs succeeded
+	Seed      int             `json:"seed"`      // Seed of the masking file, 0 when missing
+	SeedFixed bool            `json:"seedFixed"` // Without a seed, masks are expected to differ between runs
+	Rows      int             `json:"rows"`
+	Fields    []FieldCheck    `json:"fields"`
+	Problems  int             `json:"problems"` // Number of fields with problems
+	Errors    []PimoRuleError `json:"errors"`
+}
+
+// isBlankValue tells whether a value carries no data: null, or an empty string.
+func isBlankValue(value interface{}) bool {
+	return value == nil || value == ""
+}
+
+// fieldMasked tells whether a rule with a mask selects a field, or an object containing it.
+func fieldMasked(rules []pimoRule, field string) bool {
+	for _, rule := range rules {
+		if rule.masked && (rule.path == field || strings.HasPrefix(field, rule.path+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMasking runs a masking file twice over the same rows, and reports the fields masked differently
+// by the two runs (when the seed is fixed) and the masked fields keeping their original values.
+func checkMasking(ctx context.Context, executor *Executor, req PimoExecRequest) (MaskingCheckReport, error) {
+	report := MaskingCheckReport{Success: true, Fields: []FieldCheck{}, Errors: []PimoRuleError{}}
+	input, err := parseJSONLines(req.JSON)
+	if err != nil {
+		return report, fmt.Errorf("invalid JSON lines: %w", err)
+	}
+	var schema MaskingSchema
+	if err := yaml.Unmarshal([]byte(req.YAML), &schema); err == nil {
+		report.Seed, report.SeedFixed = schema.Seed, schema.Seed != 0
+	}
+	rules := pimoRules(req.YAML)
+
+	var runs [2][]interface{}
+	for i := range runs {
+		res, err := runPimo(ctx, executor, req)
+		if err != nil && res.ExitCode <= 0 {
+			return report, err
+		}
+		report.Errors = append(report.Errors, parsePimoErrors(res.Stderr, rules)...)
+		if err != nil {
+			report.Success = false
+			return report, nil
+		}
+		if runs[i], err = parseJSONLines(string(bytes.TrimSpace(res.Stdout))); err != nil {
+			report.Success = false
+			report.Errors = append(report.Errors, PimoRuleError{Rule: -1, Level: "error", Message: fmt.Sprintf("invalid pimo output, %v", err)})
+			return report, nil
+		}
+	}
+
+	checks := make(map[string]*FieldCheck)
+	report.Rows = len(input)
+	for row := range input {
+		before := map[string]interface{}{}
+		flattenFields("", input[row], before)
+		var first, second map[string]interface{}
+		if row < len(runs[0]) && row < len(runs[1]) {
+			first, second = map[string]interface{}{}, map[string]interface{}{}
+			flattenFields("", runs[0][row], first)
+			flattenFields("", runs[1][row], second)
+		}
+		for field, value := range before {
+			check, ok := checks[field]
+			if !ok {
+				check = &FieldCheck{Field: field, Masked: fieldMasked(rules, field), Problems: []string{}}
+				checks[field] = check
+			}
+			if isBlankValue(value) || first == nil {
+				continue
+			}
+			check.Values++
+			masked, kept := first[field]
+			if kept && !sameValue(masked, second[field]) {
+				check.Unstable++
+			}
+			if kept && sameValue(value, masked) {
+				check.Leaks++
+			}
+		}
+	}
+
+	for _, check := range checks {
+		if check.Unstable > 0 && report.SeedFixed {
+			check.Problems = append(check.Problems, CHECK_UNSTABLE)
+		}
+		switch {
+		case !check.Masked || check.Leaks == 0:
+		case check.Leaks == check.Values:
+			check.Problems = append(check.Problems, CHECK_LEAK)
+		default:
+			check.Problems = append(check.Problems, CHECK_PARTIAL_LEAK)
+		}
+		if len(check.Problems) > 0 {
+			report.Problems++
+		}
+		report.Fields = append(report.Fields, *check)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Field < report.Fields[j].Field })
+	return report, nil
+}
+
+// writeMaskingCheck answers the masking check of a request.
+func writeMaskingCheck(w http.ResponseWriter, r *http.Request, executor *Executor, req PimoExecRequest) {
+	report, err := checkMasking(r.Context(), executor, req)
+	if err != nil {
+		log.Printf("Failed to check masking: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to check masking: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode masking check to JSON: %v", err)
+	}
+}
+
+// pimoCheckHandler checks the masking file of the request over its JSON lines.
+func pimoCheckHandler(executor *Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PimoExecRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if _, err := parseJSONLines(req.JSON); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON lines: %v", err), http.StatusBadRequest)
+			return
+		}
+		writeMaskingCheck(w, r, executor, req)
+	}
+}
+
+// maskingCheckHandler checks the masking file of a table over synthetic rows of the table, see generateSampleRows.
+// The number of rows is given by ?n= (20 by default).
+func maskingCheckHandler(store *ProjectStore, ws *Workspace, executor *Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		tableName := chi.URLParam(r, "table")
+		n := SAMPLE_ROWS_DEFAULT
+		if value := r.URL.Query().Get("n"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > SAMPLE_ROWS_MAX {
+				http.Error(w, fmt.Sprintf("n must be a number of rows between 1 and %d", SAMPLE_ROWS_MAX), http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
+
+		snap := store.Snapshot()
+		tableFolder, table, err := findTableLocation(snap.Data, tableName, folderName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		filePath, err := maskingFilePath(ws, tableFolder, tableName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		content, err := os.ReadFile(filePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, fmt.Sprintf("table '%s' has no masking file", tableName), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rows, err := generateSampleRows(snap.Data[tableFolder], *table, n, rand.New(rand.NewPCG(1, 1)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeMaskingCheck(w, r, executor, PimoExecRequest{YAML: string(content), JSON: string(rows)})
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Statuses of a field, or of a row, in a masking preview.
+const (
+	DIFF_UNCHANGED = "unchanged"
+	DIFF_CHANGED   = "changed"
+	DIFF_REMOVED   = "removed" // In the input only
+	DIFF_ADDED     = "added"   // In the output only
+)
+
+var (
+	// pimoLogFieldRegex matches the key=value fields of a pimo console log line.
+	pimoLogFieldRegex = regexp.MustCompile(`([A-Za-z][\w-]*)=("(?:[^"\\]|\\.)*"|\S+)`)
+	// yamlLineRegex matches the line of a YAML error, e.g. "yaml: line 7: mapping values are not allowed".
+	yamlLineRegex = regexp.MustCompile(`line (\d+)`)
+	// pimoLogLevels are the levels of the pimo console log, as zerolog abbreviates them.
+	pimoLogLevels = map[string]string{"TRC": "trace", "DBG": "debug", "INF": "info", "WRN": "warn", "ERR": "error", "FTL": "fatal", "PNC": "panic"}
+)
+
+// FieldDiff is a field of a row before and after masking. Nested objects are flattened to paths like "address.city".
+type FieldDiff struct {
+	Field  string      `json:"field"`
+	Status string      `json:"status"` // See DIFF_*
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// RowDiff compares an input row with the row pimo output for it.
+type RowDiff struct {
+	Row    int         `json:"row"`    // 1-based, among the non-empty lines
+	Status string      `json:"status"` // changed when any field changed, was removed or added
+	Fields []FieldDiff `json:"fields"`
+}
+
+// PimoRuleError is a warning or an error logged by pimo, attached to the masking rule it is about when known.
+type PimoRuleError struct {
+	Rule     int    `json:"rule"`               // Index of the rule in the masking list, -1 when unknown
+	Selector string `json:"selector,omitempty"` // Jsonpath of the rule
+	Level    string `json:"level"`              // warn, error, fatal...
+	Message  string `json:"message"`
+}
+
+// PimoPreview is the result of masking sample rows: the diff of each row and the errors of the rules.
+type PimoPreview struct {
+	Success bool            `json:"success"` // pimo exited normally
+	Rows    []RowDiff       `json:"rows"`
+	Counts  map[string]int  `json:"counts"` // Number of fields by status
+	Errors  []PimoRuleError `json:"errors"`
+	Stderr  string          `json:"stderr"`
+}
+
+// pimoRule is a rule of the masking file of a preview, with the lines it spans.
+type pimoRule struct {
+	path       string // Normalized jsonpath
+	masked     bool   // The rule has a mask, unlike the boilerplate rules left to fill
+	start, end int    // 1-based lines, end excluded
+}
+
+// parseJSONLines decodes the non-empty lines of a JSONL text, keeping numbers as written.
+func parseJSONLines(text string) ([]interface{}, error) {
+	rows := []interface{}{}
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.UseNumber()
+		var row interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// flattenFields collects the leaf values of a row by path. Objects are walked, arrays are kept whole.
+func flattenFields(prefix string, value interface{}, fields map[string]interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok || (len(object) == 0 && prefix != "") {
+		if prefix == "" {
+			prefix = "$" // A row which is not an object
+		}
+		fields[prefix] = value
+		return
+	}
+	for key, child := range object {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenFields(key, child, fields)
+	}
+}
+
+// diffRows compares the input rows with the output rows, by position.
+func diffRows(before, after []interface{}, counts map[string]int) []RowDiff {
+	rows := []RowDiff{}
+	for i := 0; i < max(len(before), len(after)); i++ {
+		beforeFields, afterFields := map[string]interface{}{}, map[string]interface{}{}
+		if i < len(before) {
+			flattenFields("", before[i], beforeFields)
+		}
+		if i < len(after) {
+			flattenFields("", after[i], afterFields)
+		}
+
+		paths := make([]string, 0, len(beforeFields)+len(afterFields))
+		for path := range beforeFields {
+			paths = append(paths, path)
+		}
+		for path := range afterFields {
+			if _, ok := beforeFields[path]; !ok {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+
+		row := RowDiff{Row: i + 1, Status: DIFF_UNCHANGED, Fields: []FieldDiff{}}
+		for _, path := range paths {
+			beforeValue, inBefore := beforeFields[path]
+			afterValue, inAfter := afterFields[path]
+			status := DIFF_UNCHANGED
+			switch {
+			case !inAfter:
+				status = DIFF_REMOVED
+			case !inBefore:
+				status = DIFF_ADDED
+			case !sameValue(beforeValue, afterValue):
+				status = DIFF_CHANGED
+			}
+			if status != DIFF_UNCHANGED {
+				row.Status = DIFF_CHANGED
+			}
+			counts[status]++
+			row.Fields = append(row.Fields, FieldDiff{Field: path, Status: status, Before: beforeValue, After: afterValue})
+		}
+		switch {
+		case i >= len(after):
+			row.Status = DIFF_REMOVED
+		case i >= len(before):
+			row.Status = DIFF_ADDED
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// sameValue compares two decoded JSON values, numbers by value: 1.50 is the same as 1.5.
+func sameValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okX := new(big.Float).SetPrec(256).SetString(a.String())
+		y, okY := new(big.Float).SetPrec(256).SetString(b.String())
+		return a == b || (okX && okY && x.Cmp(y) == 0)
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !sameValue(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			if other, ok := b[key]; !ok || !sameValue(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// pimoRules lists the rules of a masking file with their lines, or nothing when it is not valid YAML.
+func pimoRules(content string) []pimoRule {
+	doc, err := parseYAMLDocument([]byte(content))
+	if err != nil {
+		return nil
+	}
+	seq := mappingValue(doc.root, "masking")
+	if !isBlockSequence(seq) {
+		return nil
+	}
+	rules := make([]pimoRule, len(seq.Content))
+	for i, item := range seq.Content {
+		start, end := doc.itemLines(seq, i)
+		mask := mappingValue(item, "mask")
+		masked := mappingValue(item, "masks") != nil || mask != nil && !isEmptyMask(mask)
+		rules[i] = pimoRule{path: ruleColumnPath(item), masked: masked, start: start + 1, end: end + 1}
+	}
+	return rules
+}
+
+// findPimoRule returns the index of the rule selecting a path, or spanning a line of the masking file, or -1.
+func findPimoRule(rules []pimoRule, path string, line int) int {
+	if path != "" {
+		path = selectorPath(normalizeSelector(path))
+		for i, rule := range rules {
+			if rule.path == path {
+				return i
+			}
+		}
+	}
+	for i, rule := range rules {
+		if rule.start <= line && line < rule.end {
+			return i
+		}
+	}
+	return -1
+}
+
+// parsePimoErrors reads the warnings and errors of the pimo log, in JSON or console format,
+// and attaches them to the masking rules they are about: by the path they mention, or by the
+// line of the masking file given in YAML errors.
+func parsePimoErrors(stderr []byte, rules []pimoRule) []PimoRuleError {
+	ruleErrors := []PimoRuleError{}
+	for _, line := range strings.Split(string(stderr), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		level, message := "error", line
+		fields := map[string]string{}
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) == nil {
+			for key, value := range entry {
+				fields[key] = fmt.Sprint(value)
+			}
+			level, message = fields["level"], fields["message"]
+		} else {
+			tokens := strings.Fields(line)
+			for i, token := range tokens {
+				if name, ok := pimoLogLevels[token]; ok && i < 2 {
+					level, message = name, strings.Join(tokens[i+1:], " ")
+					break
+				}
+			}
+			for _, match := range pimoLogFieldRegex.FindAllStringSubmatch(message, -1) {
+				if value, err := strconv.Unquote(match[2]); err == nil {
+					match[2] = value
+				}
+				fields[match[1]] = match[2]
+			}
+			message = strings.TrimSpace(pimoLogFieldRegex.ReplaceAllString(message, ""))
+		}
+		if level == "trace" || level == "debug" || level == "info" {
+			continue
+		}
+		if cause := fields["error"]; cause != "" {
+			message = strings.TrimSpace(message + ": " + cause)
+		}
+
+		path := fields["path"]
+		if path == "" {
+			path = fields["selector"]
+		}
+		yamlLine := 0
+		if match := yamlLineRegex.FindStringSubmatch(message); match != nil && strings.Contains(message, "yaml") {
+			yamlLine, _ = strconv.Atoi(match[1])
+		}
+		ruleError := PimoRuleError{Rule: findPimoRule(rules, path, yamlLine), Level: level, Message: message}
+		if ruleError.Rule >= 0 {
+			ruleError.Selector = rules[ruleError.Rule].path
+		}
+		ruleErrors = append(ruleErrors, ruleError)
+	}
+	return ruleErrors
+}
+
+// pimoPreviewHandler masks sample rows with a masking file and answers the diff of each row,
+// with the errors of pimo attached to the masking rules.
+func pimoPreviewHandler(executor *Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PimoExecRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		before, err := parseJSONLines(req.JSON)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid JSON lines: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		res, err := runPimo(r.Context(), executor, req, "--log-json")
+		if err != nil && res.ExitCode <= 0 {
+			log.Printf("Error executing pimo command: %v", err)
+			http.Error(w, fmt.Sprintf("Failed to execute pimo command: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		preview := PimoPreview{
+			Success: err == nil,
+			Counts:  map[string]int{},
+			Errors:  parsePimoErrors(res.Stderr, pimoRules(req.YAML)),
+			Stderr:  string(res.Stderr),
+		}
+		after, parseErr := parseJSONLines(string(bytes.TrimSpace(res.Stdout)))
+		if parseErr != nil {
+			preview.Success = false
+			preview.Errors = append(preview.Errors, PimoRuleError{Rule: -1, Level: "error", Message: fmt.Sprintf("invalid pimo output, %v", parseErr)})
+		}
+		preview.Rows = diffRows(before, after, preview.Counts)
+
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if err := json.NewEncoder(w).Encode(preview); err != nil {
+			log.Printf("Failed to encode pimo preview to JSON: %v", err)
+		}
+	}
+}
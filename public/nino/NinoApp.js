@@ -10,6 +10,9 @@ const ninoExecution = document.querySelector('nino-execution');
 const ninoWorkspace = document.querySelector('nino-workspace');
 
 window.openTableStat = openTableStat;
+window.editMask = editMask;
+window.acceptRelation = acceptRelation;
+window.toggleFields = toggleFields;
 window.openExecutionGraph = openExecutionGraph;
 $(sidebarToggle).on("click", toggleSidebar);
 
@@ -19,13 +22,32 @@ async function _createFileOrFolder(apiCall, ...args) {
     console.log(result);
 }
 
+/**
+ * Calls a workspace file operation (delete, move, copy) and refreshes the file tree.
+ * @param {string} url - The API endpoint.
+ * @param {Object} options - The fetch options.
+ */
+async function _fileOperation(url, options) {
+    const response = await fetch(url, options);
+    if (!response.ok) {
+        alert(await response.text());
+        return;
+    }
+    ninoWorkspace.refreshWorkspace();
+}
+
 /**
  * @typedef {Object} Nĭnŏ
  * @property {function(string, string): Promise<void>} createMasking - Creates a masking file.
+ * @property {function(string, string): Promise<void>} syncMasking - Updates a masking file with the columns of its table.
+ * @property {function(string, string): Promise<void>} suggestMasking - Fills the empty masks of a masking file with suggested masks.
  * @property {function(string, string): Promise<void>} createPlaybook - Creates a playbook file.
  * @property {function(string, string): Promise<void>} createBash - Creates a bash script.
  * @property {function(string, string): Promise<void>} createDataconnector - Creates a dataconnector file.
  * @property {function(string): Promise<void>} createFolder - Creates a folder.
+ * @property {function(string, boolean): Promise<void>} deleteFile - Deletes a file, or a folder.
+ * @property {function(string, string): Promise<void>} moveFile - Renames or moves a file or a folder.
+ * @property {function(string, string): Promise<void>} copyFile - Duplicates a file or a folder.
  * @property {function(): Object} editors - Returns all editor instances.
  * @property {function(): HTMLElement} inputEditor - Returns the input editor instance.
  * @property {function(): HTMLElement} outputEditor - Returns the output editor instance.
@@ -38,10 +60,15 @@ async function _createFileOrFolder(apiCall, ...args) {
  */
 export const Nĭnŏ = {
     createMasking: (folderName, tableName) => _createFileOrFolder(NĭnŏAPI.createMasking, folderName, tableName),
+    syncMasking: (folderName, tableName) => _fileOperation(NĭnŏAPI.syncMasking(folderName, tableName), { method: 'GET' }),
+    suggestMasking: (folderName, tableName) => _fileOperation(NĭnŏAPI.suggestMasking(folderName, tableName), { method: 'POST' }),
     createPlaybook: (folderName) => _createFileOrFolder(NĭnŏAPI.createPlaybook, folderName),
     createBash: (folderName) => _createFileOrFolder(NĭnŏAPI.createBash, folderName),
     createDataconnector: (folderName) => _createFileOrFolder(NĭnŏAPI.createDataConnector, folderName),
     createFolder: (folderName) => _createFileOrFolder(NĭnŏAPI.postFolder, folderName),
+    deleteFile: (path, recursive) => _fileOperation(NĭnŏAPI.deleteFile(path, recursive), { method: 'DELETE' }),
+    moveFile: (from, to) => _fileOperation(NĭnŏAPI.moveFile(), { method: 'POST', body: JSON.stringify({ from, to }) }),
+    copyFile: (from, to) => _fileOperation(NĭnŏAPI.copyFile(), { method: 'POST', body: JSON.stringify({ from, to }) }),
 
     // UI elements
     editors: () => ninoEditor.editorInstances,
@@ -60,6 +87,23 @@ window.Nĭnŏ = Nĭnŏ;
 
 
 makeHorizontalResizable();
+listenProjectEvents();
+
+
+/**
+ * Subscribes to the backend Server-Sent Events stream. Each time the project changes on disk
+ * (external editor, lino analyse, save from another tab...), the graphs and the file tree refresh themselves.
+ * EventSource reconnects on its own if the daemon restarts.
+ */
+function listenProjectEvents() {
+    const events = new EventSource(NĭnŏAPI.getEvents());
+    events.addEventListener('project-changed', (e) => {
+        const event = JSON.parse(e.data);
+        console.log(`Project changed (revision ${event.revision}):`, event.files);
+        ninoEditor.refreshGraphs();
+        ninoWorkspace.refreshWorkspace();
+    });
+}
 
 
 /**
@@ -141,6 +185,65 @@ function openTableStat(tableName, folderName) {
     ninoEditor.statsViewContainer.setAttribute('table-name', tableName)
 }
 
+/**
+ * editMask
+ *
+ * Edits the mask of a single column, from the "Mask" cell of the schema graph.
+ * The rule is edited as JSON, e.g. {"mask": {"regex": "[0-9]{10}"}}; an empty answer removes it.
+ * The graph refreshes itself with the project-changed event of the save.
+ *
+ * @param {string} tableName - The name of the table.
+ * @param {string} folderName - The name of the folder where the table definition resides.
+ * @param {string} column - The name of the column.
+ */
+async function editMask(tableName, folderName, column) {
+    const url = NĭnŏAPI.columnMask(folderName, tableName, column);
+    const current = await fetch(url);
+    const rule = current.ok ? await current.json() : {};
+    const headers = current.ok ? { 'If-Match': current.headers.get('ETag') } : {};
+
+    const initial = rule.masks ? { masks: rule.masks } : { mask: rule.mask || {} };
+    if (rule.cache) initial.cache = rule.cache;
+    const value = prompt(`Mask of ${tableName}.${column} (empty to remove)`, JSON.stringify(initial));
+    if (value === null) return;
+
+    const response = value.trim() === ''
+        ? await fetch(url, { method: 'DELETE', headers })
+        : await fetch(url, { method: 'PUT', headers, body: value });
+    if (!response.ok) {
+        alert(await response.text());
+    }
+}
+
+/**
+ * acceptRelation
+ *
+ * Adds a suggested relation, drawn as a dashed edge of the schema graph, to the relations.yaml of its folder.
+ * The graph refreshes itself with the project-changed event of the save.
+ *
+ * @param {string} folderName - The name of the folder of the relation.
+ * @param {string} name - The name of the suggested relation.
+ */
+async function acceptRelation(folderName, name) {
+    if (!confirm(`Add the suggested relation ${name} to ${folderName}/relations.yaml?`)) return;
+    const response = await fetch(NĭnŏAPI.acceptRelation(folderName, name), { method: 'POST' });
+    if (!response.ok) {
+        alert(await response.text());
+    }
+}
+
+/**
+ * toggleFields
+ *
+ * Shows or hides the masks of the JSON sub-fields of a column, collapsed by default under a toggle row of the schema graph.
+ *
+ * @param {string} tableName - The name of the table.
+ * @param {string} column - The name of the column.
+ */
+function toggleFields(tableName, column) {
+    ninoEditor.toggleExpandedField(`${tableName}.${column}`);
+}
+
 /**
  * openExecutionGraph
  *
@@ -216,16 +319,55 @@ async function handleFileAction(event) {
 
     if (action == 'save') {
         let url = NĭnŏAPI.postFile(example.folderName, example.name);
-        const response = await fetch(url, {
-            method: 'POST',
-            headers: { 'Content-Type': 'text/plain' },
-            body: ninoEditor.editorInstances[ninoEditor.activeTab].getValue()
-        });
+        const tabId = ninoEditor.activeTab;
+        const editor = ninoEditor.editorInstances[tabId];
+        let response = await saveFile(url, editor.getValue(), ninoEditor.fileETags[tabId]);
+
+        // Someone else saved the file since it was opened: let the user choose which version wins.
+        if (response.status === 412) {
+            const current = await response.text();
+            const etag = response.headers.get('ETag');
+            if (confirm(`${example.name} was modified by someone else since you opened it.\nOK to overwrite it with your version, Cancel to load theirs.`)) {
+                response = await saveFile(url, editor.getValue(), etag);
+            } else {
+                ninoEditor.fileETags[tabId] = etag;
+                editor.setValue(current);
+                ninoExecution.setOutputEditorValue(`Reloaded ${example.name} with its current content`);
+                return;
+            }
+        }
+        if (response.ok) {
+            ninoEditor.fileETags[tabId] = response.headers.get('ETag');
+        }
         const text = await response.text();
         ninoExecution.setOutputEditorValue(text);
     }
 }
 
+/**
+ * Saves a file, only if it still has the given ETag on the server.
+ * Without an ETag, the content cannot be known to be based on the current file: the current
+ * content is fetched and returned as a conflict, so that the user chooses which version wins.
+ * @param {string} url - The file endpoint.
+ * @param {string} content - The new content.
+ * @param {string} etag - The ETag the content was based on.
+ * @returns {Promise<Response>} 200 when saved, 412 with the current content on conflict.
+ */
+async function saveFile(url, content, etag) {
+    if (!etag) {
+        const current = await fetch(url, { cache: 'no-store' });
+        if (!current.ok || !current.headers.get('ETag')) {
+            return new Response(`Failed to save: the current version of the file could not be read (${current.status})`, { status: 428 });
+        }
+        return new Response(await current.text(), { status: 412, headers: { 'ETag': current.headers.get('ETag') } });
+    }
+    return fetch(url, {
+        method: 'POST',
+        headers: { 'Content-Type': 'text/plain', 'If-Match': etag },
+        body: content
+    });
+}
+
 /**
  * Handles the selection of an example from the static examples menu or a file from the workspace tree.
  * It loads the corresponding content into the main YAML and input editors.
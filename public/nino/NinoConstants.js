@@ -299,10 +299,26 @@ export const NĭnŏAPI = {
         `/api/file/${folderName}/${filename}`,
     postFolder: (folderName) =>
         `/api/folder/${folderName}`,
+    deleteFile: (path, recursive) =>
+        `/api/file/${path}${recursive ? '?recursive=true' : ''}`,
+    moveFile: () =>
+        '/api/move',
+    copyFile: () =>
+        '/api/copy',
 
     // New business files 
     createMasking: (folderName, tableName) =>
         `/api/new/mask/${folderName}/${tableName}`,
+    syncMasking: (folderName, tableName) =>
+        `/api/new/mask/${folderName}/${tableName}?sync=true`,
+    suggestMasking: (folderName, tableName) =>
+        `/api/suggest/mask/${folderName}/${tableName}`,
+    columnMask: (folderName, tableName, column) =>
+        `/api/masking/${folderName}/${tableName}/${encodeURIComponent(column)}`,
+    suggestRelations: (folderName) =>
+        `/api/relations/suggest/${folderName}`,
+    acceptRelation: (folderName, name) =>
+        `/api/relations/suggest/${folderName}?name=${encodeURIComponent(name)}`,
     createPlaybook: (folderName) =>
         `/api/new/playbook/${folderName}`,
     createDataConnector: (folderName) =>
@@ -311,8 +327,12 @@ export const NĭnŏAPI = {
         `/api/new/bash/${folderName}`,
 
     // Execution of Business commands in the backend
+    sampleRows: (folderName, tableName, n = 20) =>
+        `/api/sample/${folderName}/${tableName}?n=${n}`,
     execPimo: () =>
         '/api/exec/pimo',
+    previewPimo: () =>
+        '/api/exec/pimo/preview',
     execPlaybook: (folder, filename) =>
         `/api/exec/playbook/${folder}/${filename}`,
     execPull: (folder, filename) =>
@@ -328,6 +348,10 @@ export const NĭnŏAPI = {
     getPlaybook: (folder) =>
         `/api/playbook/${folder}`,
 
+    // Server-Sent Events notifying project changes
+    getEvents: () =>
+        '/api/events',
+
 };
 
 /** @type {FileType} */
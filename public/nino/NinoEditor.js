@@ -10,6 +10,8 @@ class NinoEditor extends HTMLElement {
     this.attachShadow({ mode: 'open' });
     this.jsyaml = null;
     this.editorInstances = {};
+    this.fileETags = {}; // ETag of each opened file, sent back in If-Match when saving
+    this.expandedFields = new Set(); // "table.column" of the columns whose sub-field masks the graph shows
     this.activeTab = 'example';
     this.yamlEditorFileType = 'yaml'; // Default file type for YAML editor // Default file type for YAML editor
 
@@ -163,8 +165,36 @@ class NinoEditor extends HTMLElement {
     this.layoutEditors();
   }
 
+  /**
+   * Re-fetches the transformation and execution graphs, e.g. after the project changed on disk.
+   * Unchanged graphs are cheap to revalidate thanks to the ETag sent by the backend.
+   */
+  refreshGraphs() {
+    this.graphTransformation.render();
+    this.graphExecution.render();
+  }
+
   updateGraphTab(data) {
-    this.graphTransformation.setAttribute("url", data.url || '/api/schema.dot');
+    this.graphUrl = data.url || '/api/schema.dot';
+    this.graphTransformation.setAttribute("url", this.expandedGraphUrl());
+  }
+
+  /**
+   * Shows or hides the masks of the JSON sub-fields of a column in the transformation graph.
+   * @param {string} field - The column, as "table.column".
+   */
+  toggleExpandedField(field) {
+    if (!this.expandedFields.delete(field)) {
+      this.expandedFields.add(field);
+    }
+    this.graphTransformation.setAttribute("url", this.expandedGraphUrl());
+  }
+
+  expandedGraphUrl() {
+    const url = new URL(this.graphUrl || this.graphTransformation.getAttribute("url"), window.location.origin);
+    url.searchParams.delete('expand');
+    this.expandedFields.forEach(field => url.searchParams.append('expand', field));
+    return url.pathname + url.search;
   }
 
   renderExecutionPlanTab(folderName) {
@@ -291,6 +321,7 @@ class NinoEditor extends HTMLElement {
       try {
         const response = await fetch(url);
         const text = await response.text();
+        this.fileETags[tabId] = response.headers.get('ETag');
         this.editorInstances[tabId].setValue(text);
       } catch (err) {
         this.editorInstances[tabId].setValue(`# Failed to load: ${url}`);
@@ -307,6 +338,7 @@ class NinoEditor extends HTMLElement {
       if (this.editorInstances[tabId]) {
         // The NinoMonacoEditor component handles its own disposal in disconnectedCallback
         delete this.editorInstances[tabId];
+        delete this.fileETags[tabId];
       }
 
       // Remove tab button and editor container
@@ -40,6 +40,9 @@ class NinoExecution extends HTMLElement {
                     <button id="fetch-row-btn" class="execute-btn" style="display: none;">
                         <span class="refresh-icon">↻</span> fetch 1 row 
                     </button>
+                    <button id="sample-rows-btn" class="execute-btn" style="display: none;">
+                        <span>sample rows</span>
+                    </button>
                 </div>
                 <nino-monaco-editor
                     id="input-editor"
@@ -52,6 +55,9 @@ class NinoExecution extends HTMLElement {
                         <i class="iPlay mediumIcon"></i>
                         <span>Output</span>
                     </button>
+                    <button id="preview-btn" class="execute-btn">
+                        <span>Diff</span>
+                    </button>
                     
                 </div>
                 <nino-monaco-editor
@@ -69,6 +75,8 @@ class NinoExecution extends HTMLElement {
         this.outputEditor = this.shadowRoot.getElementById('output-editor');
         this.executeBtn = this.shadowRoot.getElementById('execute-btn');
         this.fetchRowBtn = this.shadowRoot.getElementById('fetch-row-btn');
+        this.previewBtn = this.shadowRoot.getElementById('preview-btn');
+        this.sampleRowsBtn = this.shadowRoot.getElementById('sample-rows-btn');
 
         this.executeBtn.addEventListener('click', () => {
             const yamlValue = Nĭnŏ.getCurrentTabContent();
@@ -76,7 +84,12 @@ class NinoExecution extends HTMLElement {
             this.handlePimoExecution(yamlValue, jsonValue);
         });
 
+        this.previewBtn.addEventListener('click', () => {
+            this.handlePimoPreview(Nĭnŏ.getCurrentTabContent(), this.inputEditor.getValue());
+        });
+
         this.fetchRowBtn.addEventListener('click', this.handleFetchRow.bind(this));
+        this.sampleRowsBtn.addEventListener('click', this.handleSampleRows.bind(this));
     }
 
     _setButtonState(button, disabled, text) {
@@ -109,7 +122,7 @@ class NinoExecution extends HTMLElement {
                 headers: { "Content-Type": "application/json" },
                 body: JSON.stringify({
                     yaml: yamlValue,
-                    json: JSON.stringify(JSON.parse(jsonValue)),
+                    json: this._compactJSON(jsonValue),
                 }),
             });
     
@@ -132,14 +145,100 @@ class NinoExecution extends HTMLElement {
     }
 
     /**
-     * Shows or hides the 'fetch 1 row' button based on the active file type.
+     * Masks the input rows (one JSON object per line) and shows, for each row, the fields
+     * pimo changed (~), removed (-) or added (+), then the errors of the masking rules.
+     */
+    async handlePimoPreview(yamlValue, jsonValue) {
+        this._setButtonState(this.previewBtn, true, "Diffing...");
+        this.setOutputEditorLanguage('shell');
+        this.outputEditor.setValue("");
+
+        try {
+            const response = await fetch(NĭnŏAPI.previewPimo(), {
+                method: "POST",
+                headers: { "Content-Type": "application/json" },
+                body: JSON.stringify({ yaml: yamlValue, json: jsonValue }),
+            });
+            if (!response.ok) {
+                this.outputEditor.setValue(`Preview failed: ${await response.text()}`);
+                return;
+            }
+            const preview = await response.json();
+            const marks = { changed: '~', removed: '-', added: '+' };
+            const lines = [];
+            for (const row of preview.rows) {
+                lines.push(`row ${row.row}: ${row.status}`);
+                for (const field of row.fields.filter(f => f.status !== 'unchanged')) {
+                    const values = {
+                        changed: `${JSON.stringify(field.before)} → ${JSON.stringify(field.after)}`,
+                        removed: JSON.stringify(field.before),
+                        added: JSON.stringify(field.after),
+                    };
+                    lines.push(`  ${marks[field.status]} ${field.field}: ${values[field.status]}`);
+                }
+            }
+            if (preview.errors.length > 0) {
+                lines.push('', 'errors:');
+                for (const error of preview.errors) {
+                    const rule = error.rule >= 0 ? `rule ${error.rule} (${error.selector})` : 'pimo';
+                    lines.push(`  ${rule} ${error.level}: ${error.message}`);
+                }
+            }
+            this.outputEditor.setValue(lines.join('\n'));
+        } catch (error) {
+            this.outputEditor.setValue("API request failed");
+        } finally {
+            this._setButtonState(this.previewBtn, false, "Diff");
+        }
+    }
+
+    /**
+     * Compacts a pretty-printed JSON object onto a single line; JSON lines are sent as they are.
+     */
+    _compactJSON(jsonValue) {
+        try {
+            return JSON.stringify(JSON.parse(jsonValue));
+        } catch (error) {
+            return jsonValue;
+        }
+    }
+
+    /**
+     * Shows or hides the 'fetch 1 row' and 'sample rows' buttons based on the active file type.
      */
     updateFetchRowButton() {
         const { fileName } = this._activeFile;
-        if (fileName && fileName.includes('masking.yaml')) {
-            this.fetchRowBtn.style.display = 'inline-flex';
-        } else {
-            this.fetchRowBtn.style.display = 'none';
+        const display = fileName && fileName.includes('masking.yaml') ? 'inline-flex' : 'none';
+        this.fetchRowBtn.style.display = display;
+        this.sampleRowsBtn.style.display = display;
+    }
+
+    /**
+     * Fills the input with synthetic rows of the table of the masking file, generated from
+     * its tables.yaml and analyze.yaml, to try the masks without database access.
+     */
+    async handleSampleRows() {
+        const { fileName, folderName } = this._activeFile;
+        if (!fileName || !folderName) {
+            console.error("Missing file name or folder name for sample rows.");
+            return;
+        }
+        const tableName = fileName.split('/').pop().replace(/-masking\.yaml$/, '');
+
+        this._setButtonState(this.sampleRowsBtn, true, '...');
+        try {
+            const response = await fetch(NĭnŏAPI.sampleRows(folderName, tableName));
+            const result = await response.text();
+            if (!response.ok) {
+                this.setOutputEditorValue(`Error generating sample rows: ${result}`);
+            } else {
+                this.setInputEditorValue(result);
+                this.setInputEditorLanguage('json');
+            }
+        } catch (error) {
+            this.setOutputEditorValue(`API request failed during sample: ${error.message}`);
+        } finally {
+            this._setButtonState(this.sampleRowsBtn, false, 'sample rows');
         }
     }
 
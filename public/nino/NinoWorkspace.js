@@ -85,6 +85,20 @@ class NinoWorkspace extends HTMLElement {
         this.renderFileTree(jstreeData);
     }
 
+    /**
+     * Reloads the file tree in place, keeping the jstree instance and its opened/selected state.
+     */
+    async refreshWorkspace() {
+        const jstreeData = await this.fetchWorkspaceFiles();
+        const tree = $(this.shadowRoot.querySelector("#jstree-workspace")).jstree(true);
+        if (!tree) {
+            this.renderFileTree(jstreeData);
+            return;
+        }
+        tree.settings.core.data = jstreeData;
+        tree.refresh(true);
+    }
+
     /**
     * Fetches workspace files from the backend API and transforms them into jstree-compatible data.
     */
@@ -111,61 +125,72 @@ class NinoWorkspace extends HTMLElement {
 
             let currentIdCounter = 1; // Use a local counter for unique IDs
 
+            // Icons of the nino file types detected by the backend.
+            const kindIcons = {
+                masking: 'iMask',
+                dataconnector: 'iDataconnector',
+                playbook: 'iAnsible',
+                bash: 'iBash',
+            };
+
             /**
-             * Recursively processes a node (folder or file) from the input data
-             * and adds it to the jstreeData array.
-             * Recursively processes a node (folder or file) from the input data and adds it to the jstreeData array.
-             * @param {Array<string|object>} items - An array of file names (strings) or folder objects.
+             * Recursively processes the nodes (folders and files) returned by /api/files and adds them to the jstreeData array.
+             * @param {Array<Object>} nodes - Nodes with name, path, type, kind, parseStatus, errorCount, errors, git and children.
              * @param {string} parentId - The ID of the parent node in the jstree.
-             * @param {string} currentPath - The current path in the file tree (e.g., "Workspace/folderA").
-             * @param {string} currentTreePath - The current path in the file tree (e.g., "Workspace/folderA").
-             * @param {string} currentUrlPath - The current path for constructing URLs.
              */
-            const processNode = (items, parentId, currentTreePath, currentUrlPath) => {
-                const children = [];
-                for (const item of items) {
-                    if (typeof item === 'string') { // It's a file
-                        if (item.endsWith(".yaml") || item.endsWith(".yml")) {
-                            const fileName = item;
-                            const nodeTreePath = `${currentTreePath}/${fileName}`;
-                            const nodeUrlPath = currentUrlPath ? `${currentUrlPath}/${fileName}` : fileName;
-                            jstreeData.push({
-                                id: `ws_file_${currentIdCounter++}`,
-                                parent: parentId,
-                                text: fileName,
-                                icon: 'jstree-file',
-                                li_attr: {
-                                    'data-url': `/api/file/${nodeUrlPath}`,
-                                    'data-input': '{}', // Default input for workspace files  
-                                    'data-file-name': fileName,
-                                    'data-folder-name': currentUrlPath.split('/').pop() || '', // Get the immediate parent folder name for the URL path
-                                    'data-example-id': `workspace-${nodeTreePath}` // To identify it later  
-                                },
-                                type: 'file'
-                            });
-                        }
-                    } else if (typeof item === 'object' && item !== null) { // It's a folder
-                        const folderName = Object.keys(item)[0];
-                        const folderContent = item[folderName];
+            const processNode = (nodes, parentId) => {
+                for (const node of nodes) {
+                    const classes = [];
+                    const titles = [];
+                    if (node.git) {
+                        classes.push(`git-${node.git}`);
+                        titles.push(`git: ${node.git}`);
+                    }
+                    if (node.errorCount > 0) {
+                        classes.push('has-errors');
+                        titles.push(...(node.errors || [`${node.errorCount} error(s)`]));
+                    }
+                    const a_attr = classes.length ? { class: classes.join(' '), title: titles.join('\n') } : {};
 
-                        const newFolderId = `ws_folder_${currentIdCounter++}`;
-                        const newCurrentTreePath = `${currentTreePath}/${folderName}`;
-                        const newCurrentUrlPath = currentUrlPath ? `${currentUrlPath}/${folderName}` : folderName;
+                    if (node.type === 'folder') {
+                        const folderId = `ws_folder_${currentIdCounter++}`;
                         jstreeData.push({
-                            id: newFolderId,
+                            id: folderId,
                             parent: parentId,
-                            text: folderName,
+                            text: node.name,
                             icon: 'jstree-folder',
                             state: { opened: true },
                             type: 'folder',
-                            children: processNode(folderContent, newFolderId, newCurrentTreePath, newCurrentUrlPath) // Recursively call for children
+                            li_attr: { 'data-path': node.path, 'data-folder-name': node.name },
+                            a_attr,
                         });
+                        processNode(node.children || [], folderId);
+                        continue;
                     }
+
+                    const folderPath = node.path.split('/').slice(0, -1);
+                    jstreeData.push({
+                        id: `ws_file_${currentIdCounter++}`,
+                        parent: parentId,
+                        text: node.errorCount > 0 ? `${node.name} (${node.errorCount})` : node.name,
+                        icon: kindIcons[node.kind] || 'jstree-file',
+                        li_attr: {
+                            'data-url': `/api/file/${node.path}`,
+                            'data-path': node.path,
+                            'data-kind': node.kind || '',
+                            'data-input': '{}', // Default input for workspace files  
+                            'data-file-name': node.name,
+                            'data-folder-name': folderPath.pop() || '', // The immediate parent folder name for the URL path
+                            'data-example-id': `workspace-Workspace/${node.path}` // To identify it later  
+                        },
+                        a_attr,
+                        type: 'file'
+                    });
                 }
             };
 
-            if (files.Workspace && Array.isArray(files.Workspace)) { // Assuming the top-level 'files' object contains a 'Workspace' key
-                processNode(files.Workspace, 'ws_root', 'Workspace', '');
+            if (files.Workspace && Array.isArray(files.Workspace)) { // The top-level 'files' object contains a 'Workspace' key
+                processNode(files.Workspace, 'ws_root');
             }
 
             return jstreeData;
@@ -205,6 +230,8 @@ class NinoWorkspace extends HTMLElement {
                     "items": function ($node) {
                         const directory = $node.li_attr['data-folder-name']
                         const filename = $node.li_attr['data-file-name']
+                        const path = $node.li_attr['data-path']
+                        const kind = $node.li_attr['data-kind']
                         return {
                             createFolder: {
                                 "separator_before": false,
@@ -229,6 +256,22 @@ class NinoWorkspace extends HTMLElement {
                                 "label": "Create Masking File",
                                 "action": function (obj) { Nĭnŏ.createMasking(directory, filename) },
                             },
+                            syncMasking: {
+                                "separator_before": false,
+                                "separator_after": true,
+                                "icon": 'iMask',
+                                "label": "Sync Masking File",
+                                "_disabled": kind !== 'masking',
+                                "action": function (obj) { Nĭnŏ.syncMasking(directory, filename.replace(/-masking\.yaml$/, '')) },
+                            },
+                            suggestMasking: {
+                                "separator_before": false,
+                                "separator_after": true,
+                                "icon": 'iMask',
+                                "label": "Suggest Masks",
+                                "_disabled": kind !== 'masking',
+                                "action": function (obj) { Nĭnŏ.suggestMasking(directory, filename.replace(/-masking\.yaml$/, '')) },
+                            },
                             createPlaybook: {
                                 "separator_before": false,
                                 "separator_after": true,
@@ -243,6 +286,36 @@ class NinoWorkspace extends HTMLElement {
                                 "label": "Create bash script",
                                 "action": function (obj) { Nĭnŏ.createBash(directory, filename) }
                             },
+                            rename: {
+                                "separator_before": true,
+                                "separator_after": false,
+                                "label": "Rename / Move",
+                                "_disabled": !path,
+                                "action": function (obj) {
+                                    const to = prompt("New path", path);
+                                    if (to && to !== path) Nĭnŏ.moveFile(path, to);
+                                }
+                            },
+                            duplicate: {
+                                "separator_before": false,
+                                "separator_after": false,
+                                "label": "Duplicate",
+                                "_disabled": !path,
+                                "action": function (obj) {
+                                    const to = prompt("Copy to", path);
+                                    if (to && to !== path) Nĭnŏ.copyFile(path, to);
+                                }
+                            },
+                            delete: {
+                                "separator_before": false,
+                                "separator_after": false,
+                                "label": "Delete",
+                                "_disabled": !path,
+                                "action": function (obj) {
+                                    const isFolder = $node.type === 'folder';
+                                    if (confirm(`Delete ${path}${isFolder ? ' and all its content' : ''}?`)) Nĭnŏ.deleteFile(path, isFolder);
+                                }
+                            },
                         };
                     }
                 },
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Confidence of a suggested relation.
+const (
+	CONFIDENCE_HIGH   = "high"   // The column is named after the parent table and its values fit the parent key
+	CONFIDENCE_MEDIUM = "medium" // The column is named after the parent table, its values are not analyzed
+	CONFIDENCE_LOW    = "low"    // Only the values, or only the name, point to the parent key
+)
+
+// RelationSuggestion is a relation missing from relations.yaml, inferred from the names and metrics of the columns.
+type RelationSuggestion struct {
+	Name       string            `json:"name"`
+	Parent     relationEndOutput `json:"parent"`
+	Child      relationEndOutput `json:"child"`
+	Confidence string            `json:"confidence"`
+	Reasons    []string          `json:"reasons"`
+}
+
+// referencedStem returns the table a column refers to by its name, e.g. "owner" for "owner_id", "ownerId"
+// or "ownerID", "" when it is not named like a foreign key. A bare "id" suffix only counts on a camelCase
+// boundary, so that "paid", "valid" or "uuid" are not foreign keys.
+func referencedStem(column string) string {
+	if len(column) > 3 && strings.EqualFold(column[len(column)-3:], "_id") {
+		return strings.ToLower(column[:len(column)-3])
+	}
+	if stem, ok := strings.CutSuffix(column, "Id"); ok && stem != "" && !unicode.IsUpper(rune(stem[len(stem)-1])) {
+		return strings.ToLower(stem)
+	}
+	if stem, ok := strings.CutSuffix(column, "ID"); ok && stem != "" && unicode.IsLower(rune(stem[len(stem)-1])) {
+		return strings.ToLower(stem)
+	}
+	return ""
+}
+
+// singular returns the singular of an English table name, e.g. "category" for "categories".
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"), strings.HasSuffix(name, "xes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+// nameMatch tells why a column is named after a parent table and its key, "" when it is not:
+// "owner_id" refers to "owners", "billing_owner_id" too, and "customer_id" to the table keyed by "customer_id".
+func nameMatch(column string, parent Table) string {
+	key := parent.Keys[0]
+	if strings.EqualFold(column, key) && !strings.EqualFold(key, "id") {
+		return fmt.Sprintf("named like the key of '%s'", parent.Name)
+	}
+	stem := referencedStem(column)
+	if stem == "" {
+		return ""
+	}
+	table := strings.ToLower(parent.Name)
+	for _, name := range []string{table, singular(table)} {
+		switch {
+		case stem == name:
+			return fmt.Sprintf("named after table '%s'", parent.Name)
+		case strings.HasSuffix(stem, "_"+name):
+			return fmt.Sprintf("named after table '%s', with a prefix", parent.Name)
+		}
+	}
+	return ""
+}
+
+// valuesMatch compares the analyzed values of a column with those of a key. It returns whether they fit,
+// why, and whether both are analyzed enough to tell.
+func valuesMatch(column, key AnalyzeColumn) (bool, string, bool) {
+	if column.MainMetric.Count == 0 || key.MainMetric.Count == 0 {
+		return false, "", false
+	}
+	childMin, childMax, _, childRanged := numericRange(column)
+	keyMin, keyMax, _, keyRanged := numericRange(key)
+	if childRanged && keyRanged {
+		if childMin >= keyMin && childMax <= keyMax {
+			return true, fmt.Sprintf("values %v..%v within the key range %v..%v", childMin, childMax, keyMin, keyMax), true
+		}
+		return false, fmt.Sprintf("values %v..%v out of the key range %v..%v", childMin, childMax, keyMin, keyMax), true
+	}
+
+	samples, keySamples := sampleStrings(column.MainMetric.Samples), sampleStrings(key.MainMetric.Samples)
+	if len(samples) == 0 || len(keySamples) == 0 {
+		return false, "", false
+	}
+	for _, sample := range samples {
+		if slices.Contains(keySamples, sample) {
+			return true, fmt.Sprintf("shares the key value '%s'", sample), true
+		}
+	}
+	shapes := map[string]bool{}
+	for _, sample := range keySamples {
+		shapes[sampleShape(sample)] = true
+	}
+	if allMatch(samples, func(sample string) bool { return shapes[sampleShape(sample)] }) {
+		return true, fmt.Sprintf("values formatted like the key, e.g. '%s'", samples[0]), true
+	}
+	return false, fmt.Sprintf("values formatted unlike the key, e.g. '%s'", samples[0]), true
+}
+
+// suggestRelations infers the relations missing from the relations of a folder: columns named after a table,
+// like "owner_id" for "owners", whose values fit its key, and foreign key looking columns whose values
+// fit the key of a table, by range or by format. Columns already in a relation are left out.
+func suggestRelations(folder *FolderData) []RelationSuggestion {
+	metrics := make(map[string]map[string]AnalyzeColumn)
+	for _, analyzed := range folder.Analysis.Tables {
+		metrics[analyzed.Name] = make(map[string]AnalyzeColumn)
+		for _, col := range analyzed.Columns {
+			metrics[analyzed.Name][col.Name] = col
+		}
+	}
+	tables := []Table{}
+	seen := map[string]bool{}
+	for _, table := range folder.Tables {
+		if !seen[table.Name] {
+			seen[table.Name] = true
+			tables = append(tables, table)
+		}
+	}
+	names := map[string]bool{}
+	for _, relation := range folder.Relations.Relations {
+		names[relation.Name] = true
+	}
+
+	suggestions := []RelationSuggestion{}
+	for _, child := range tables {
+		for _, column := range child.Columns {
+			role, _, _ := columnRole(child, folder.Relations.Relations, column.Name)
+			if role == ROLE_FOREIGN_KEY || len(child.Keys) == 1 && child.Keys[0] == column.Name {
+				continue
+			}
+			metric, analyzed := metrics[child.Name][column.Name]
+			candidates, byNames := []RelationSuggestion{}, []bool{}
+			for _, parent := range tables {
+				if len(parent.Keys) != 1 {
+					continue
+				}
+				key := parent.Keys[0]
+				byName := nameMatch(column.Name, parent)
+				if byName == "" && (parent.Name == child.Name || referencedStem(column.Name) == "") {
+					continue // Only foreign key looking columns are matched by their values.
+				}
+				if keyColumn := tableColumn(parent, key); keyColumn != nil && column.Export != "" && keyColumn.Export != "" && column.Export != keyColumn.Export {
+					continue
+				}
+
+				suggestion := RelationSuggestion{
+					Parent: relationEndOutput{Name: parent.Name, Keys: []string{key}},
+					Child:  relationEndOutput{Name: child.Name, Keys: []string{column.Name}},
+				}
+				keyMetric, keyAnalyzed := metrics[parent.Name][key]
+				fits, why, known := false, "", false
+				if analyzed && keyAnalyzed {
+					fits, why, known = valuesMatch(metric, keyMetric)
+				}
+				switch {
+				case byName != "" && fits:
+					suggestion.Confidence, suggestion.Reasons = CONFIDENCE_HIGH, []string{byName, why}
+				case byName != "" && !known:
+					suggestion.Confidence, suggestion.Reasons = CONFIDENCE_MEDIUM, []string{byName}
+				case byName != "":
+					suggestion.Confidence, suggestion.Reasons = CONFIDENCE_LOW, []string{byName, why}
+				case fits:
+					suggestion.Confidence, suggestion.Reasons = CONFIDENCE_LOW, []string{why}
+				default:
+					continue
+				}
+				candidates = append(candidates, suggestion)
+				byNames = append(byNames, byName != "")
+			}
+			// A column named after a table only refers to it, whatever other keys its values fit.
+			named := slices.Contains(byNames, true)
+			for i, candidate := range candidates {
+				if byNames[i] || !named {
+					suggestions = append(suggestions, candidate)
+				}
+			}
+		}
+	}
+
+	rank := map[string]int{CONFIDENCE_HIGH: 0, CONFIDENCE_MEDIUM: 1, CONFIDENCE_LOW: 2}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return rank[suggestions[i].Confidence] < rank[suggestions[j].Confidence]
+	})
+	// Relations are named fk_<child>_<column> like lino names them, with the parent when the column has several candidates.
+	for i := range suggestions {
+		suggestion := &suggestions[i]
+		name := fmt.Sprintf("fk_%s_%s", suggestion.Child.Name, suggestion.Child.Keys[0])
+		if names[name] {
+			name += "_" + suggestion.Parent.Name
+		}
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("fk_%s_%s_%s_%d", suggestion.Child.Name, suggestion.Child.Keys[0], suggestion.Parent.Name, n)
+		}
+		names[name] = true
+		suggestion.Name = name
+	}
+	return suggestions
+}
+
+// tableColumn returns the column of a table with the given name, or nil.
+func tableColumn(table Table, name string) *Column {
+	for i := range table.Columns {
+		if table.Columns[i].Name == name {
+			return &table.Columns[i]
+		}
+	}
+	return nil
+}
+
+// relationLines renders a relation as an item of the relations sequence, its dash at the given indentation.
+func relationLines(indent int, suggestion RelationSuggestion) ([]string, error) {
+	content, err := encodeYAML([]relationOutput{{Name: suggestion.Name, Parent: suggestion.Parent, Child: suggestion.Child}})
+	if err != nil {
+		return nil, err
+	}
+	pad := strings.Repeat(" ", indent)
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		lines = append(lines, pad+line)
+	}
+	return lines, nil
+}
+
+// acceptRelation appends a suggested relation to the content of a relations.yaml file, keeping the rest of it as is.
+// A missing file is created.
+func acceptRelation(content []byte, exists bool, suggestion RelationSuggestion) ([]byte, error) {
+	if !exists || len(strings.TrimSpace(string(content))) == 0 {
+		content = []byte("version: v1\n")
+	}
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	var renderErr error
+	err = doc.appendItems("relations", func(indent int) []string {
+		lines, err := relationLines(indent, suggestion)
+		renderErr = err
+		return lines
+	})
+	if renderErr != nil {
+		return nil, renderErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.bytes(), nil
+}
+
+// suggestRelationsHandler lists the relations suggested for a folder. POST accepts the suggestion of the ?name=
+// given, appending it to the relations.yaml of the folder.
+func suggestRelationsHandler(store *ProjectStore, ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		snap := store.Snapshot()
+		if r.Method == http.MethodGet && checkNotModified(w, r, snap) {
+			return
+		}
+		folder, ok := snap.Data[folderName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("folder '%s' not found", folderName), http.StatusNotFound)
+			return
+		}
+		suggestions := suggestRelations(folder)
+
+		if r.Method == http.MethodGet {
+			w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+			if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+				log.Printf("Failed to encode relation suggestions to JSON: %v", err)
+			}
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		index := slices.IndexFunc(suggestions, func(s RelationSuggestion) bool { return s.Name == name })
+		if index < 0 {
+			http.Error(w, fmt.Sprintf("no relation '%s' suggested in folder '%s'", name, folderName), http.StatusNotFound)
+			return
+		}
+		folderDir, err := ws.FolderDir(folderName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		path := filepath.Join(folderDir, RELATIONS_FILE)
+		invalid := false
+		err = ws.UpdateFileAt(path, func(content []byte, exists bool) ([]byte, error) {
+			updated, err := acceptRelation(content, exists, suggestions[index])
+			invalid = err != nil
+			return updated, err
+		})
+		if err != nil {
+			status := workspaceErrorStatus(err)
+			if invalid {
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, fmt.Sprintf("Failed to add relation '%s': %v", name, err), status)
+			return
+		}
+		log.Printf("suggestRelationsHandler: relation %s added to %s", name, path)
+		reloadSchemas(store)
+
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(suggestions[index]); err != nil {
+			log.Printf("Failed to encode relation suggestion to JSON: %v", err)
+		}
+	}
+}
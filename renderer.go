@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"html"
 	"image/color"
 	"log"
 	"math"
@@ -34,10 +36,12 @@ type subgraphModel struct {
 	targetColumnsMap      map[string]map[string]Column
 	targetAnalysisMetrics map[string]map[string]AnalyzeColumn
 	targetAnalysisTables  map[string]AnalyzeTable
+	expanded              map[string]bool // "table.column" of the columns whose sub-field masks are shown
 }
 
 // generateCombinedDotGraph creates the complete DOT graph string from all schemas.
-func generateCombinedDotGraph(projectData ProjectData, folderFilter ...string) string {
+// The masks of JSON sub-fields are collapsed under their column, unless it is expanded ("table.column").
+func generateCombinedDotGraph(projectData ProjectData, expanded map[string]bool, folderFilter ...string) string {
 	var sb strings.Builder
 
 	// Start the DOT graph definition with global settings.
@@ -74,6 +78,7 @@ func generateCombinedDotGraph(projectData ProjectData, folderFilter ...string) s
 			tableToFolder[table.Name] = folderName
 		}
 		sg := newSubgraphModel(folderName, folderData.Tables, projectData, tableToFolder)
+		sg.expanded = expanded
 		sb.WriteString(sg.generate())
 	}
 
@@ -164,8 +169,24 @@ func (sg *subgraphModel) generate() string {
 
 	sb.WriteString("    style=rounded;\n    color=olive;\n\n")
 
+	// Ranks of the tables in the load order, only shown when the folder has relations.
+	ranks := map[string]OrderedTable{}
+	if folder := sg.projectData[sg.folderName]; len(folder.Relations.Relations) > 0 {
+		for _, table := range loadOrder(sg.folderName, folder).Tables {
+			ranks[table.Name] = table
+		}
+	}
+
 	// Generate nodes for all tables in this subgraph.
 	for _, table := range sg.tables {
+		rankLabel := ""
+		if rank, ok := ranks[table.Name]; ok {
+			rankColor := "white"
+			if rank.Cycle > 0 {
+				rankColor = "#FFB0B0"
+			}
+			rankLabel = fmt.Sprintf(`<FONT COLOR="%s" POINT-SIZE="12">%d </FONT>`, rankColor, rank.Rank)
+		}
 		sourceMetricsHeader := "Metrics"
 		if sourceAnalyzedTable, ok := sg.analysisTables[table.Name]; ok && len(sourceAnalyzedTable.Columns) > 0 {
 			sourceMetricsHeader = fmt.Sprintf(`<FONT POINT-SIZE="10">Count </FONT><B><FONT POINT-SIZE="12">%d</FONT></B>`, sourceAnalyzedTable.Columns[0].MainMetric.Count)
@@ -193,11 +214,19 @@ func (sg *subgraphModel) generate() string {
 			sourceMetricsHeader,
 			targetMetricsHeader,
 			sg.targetAnalysisMetrics[table.Name],
+			rankLabel,
+			sg.expanded,
 		))
 	}
 
 	// Draw edges that are defined in the current folder's relations.yaml
 	if relSchema := sg.projectData[sg.folderName].Relations; len(relSchema.Relations) > 0 {
+		issues := make(map[string]ConsistencyIssue)
+		for _, issue := range checkConsistency(sg.projectData, sg.folderName).Issues {
+			if _, seen := issues[issue.Relation]; !seen {
+				issues[issue.Relation] = issue
+			}
+		}
 		for _, rel := range relSchema.Relations {
 			parentFolder, parentFound := sg.tableToFolder[rel.Parent.Name]
 			childFolder, childFound := sg.tableToFolder[rel.Child.Name]
@@ -215,14 +244,101 @@ func (sg *subgraphModel) generate() string {
 			uniqueParentID := fmt.Sprintf("%s_%s", parentClusterID, rel.Parent.Name)
 			uniqueChildID := fmt.Sprintf("%s_%s", childClusterID, rel.Child.Name)
 
+			if issue, ok := issues[rel.Name]; ok {
+				// Foreign keys whose masked values may not match the masked keys anymore.
+				sb.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\" [label=\" %s \", color=\"#FF0000\", fontcolor=\"#FF0000\", penwidth=2, tooltip=\"%s\", class=\"lino-edge inconsistent\"];\n", uniqueParentID, uniqueChildID, rel.Name, escapeDotString(issue.Message)))
+				continue
+			}
 			sb.WriteString(fmt.Sprintf("    \"%s\" -> \"%s\" [label=\" %s \", color=\"#555555\"];\n", uniqueParentID, uniqueChildID, rel.Name))
 		}
 	}
 
+	sb.WriteString(sg.generateSuggestedEdges(clusterID))
+	sb.WriteString(sg.generateCacheEdges(clusterID))
+
 	sb.WriteString("  }\n\n")
 	return sb.String()
 }
 
+// generateCacheEdges links the columns sharing a masking cache with dashed edges: they get the same
+// masked value for the same original value, across tables.
+func (sg *subgraphModel) generateCacheEdges(clusterID string) string {
+	maskings := sg.projectData[sg.folderName].Maskings
+	type cacheUser struct{ nodeID, column string }
+	users := make(map[string][]cacheUser)
+	caches := make(map[string]MaskingCache)
+	names := []string{}
+	for _, table := range sg.tables {
+		masking, ok := maskings[table.Name]
+		if !ok {
+			continue
+		}
+		for _, rule := range masking.Masking {
+			column, _ := rule.selector()
+			for _, cache := range rule.caches() {
+				if _, seen := users[cache]; !seen {
+					names = append(names, cache)
+				}
+				users[cache] = append(users[cache], cacheUser{fmt.Sprintf("%s_%s", clusterID, table.Name), column})
+				if declared, ok := masking.Caches[cache]; ok {
+					caches[cache] = declared
+				}
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, name := range names {
+		tooltip := fmt.Sprintf("cache %s", name)
+		if caches[name].Unique {
+			tooltip += " (unique)"
+		}
+		first := users[name][0]
+		for _, user := range users[name][1:] {
+			sb.WriteString(fmt.Sprintf("    \"%s\":\"%s\" -> \"%s\":\"%s\" [style=dashed, dir=none, constraint=false, color=\"#8A2BE2\", label=\" %s \", fontcolor=\"#8A2BE2\", tooltip=\"%s\", class=\"cache-edge\"];\n",
+				first.nodeID, columnPort(first.column), user.nodeID, columnPort(user.column), escapeDotString(name), escapeDotString(tooltip)))
+		}
+	}
+	return sb.String()
+}
+
+// generateSuggestedEdges draws the relations suggested for the folder, see suggestRelations, with dashed
+// edges from the parent key to the foreign key column. Clicking one adds it to relations.yaml.
+func (sg *subgraphModel) generateSuggestedEdges(clusterID string) string {
+	var sb strings.Builder
+	for _, suggestion := range suggestRelations(sg.projectData[sg.folderName]) {
+		tooltip := fmt.Sprintf("suggested %s (%s confidence): %s", suggestion.Name, suggestion.Confidence, strings.Join(suggestion.Reasons, ", "))
+		// The names come from identifiers which may hold quotes: JS string literals, escaped for DOT.
+		href := fmt.Sprintf("javascript:acceptRelation(%s, %s)", jsString(sg.folderName), jsString(suggestion.Name))
+		sb.WriteString(fmt.Sprintf("    \"%s_%s\":\"%s\" -> \"%s_%s\":\"%s\" [style=dashed, color=\"#999999\", label=\" suggested \", fontcolor=\"#999999\", tooltip=\"%s\", href=\"%s\", class=\"suggested-edge %s\"];\n",
+			clusterID, escapeDotString(suggestion.Parent.Name), columnPort(suggestion.Parent.Keys[0]), clusterID, escapeDotString(suggestion.Child.Name), columnPort(suggestion.Child.Keys[0]),
+			escapeDotString(tooltip), escapeDotString(href), suggestion.Confidence))
+	}
+	return sb.String()
+}
+
+// jsString renders a value as a JavaScript string literal, for the javascript: links of the graph.
+func jsString(value string) string {
+	literal, _ := json.Marshal(value)
+	return string(literal)
+}
+
+// maskEditLink returns the HREF and TOOLTIP attributes of the cells editing the mask of a column.
+func maskEditLink(tableName, folderName, column string) string {
+	href := fmt.Sprintf("javascript:editMask(%s, %s, %s)", jsString(tableName), jsString(folderName), jsString(column))
+	return fmt.Sprintf(` HREF="%s" TOOLTIP="%s"`, html.EscapeString(href), html.EscapeString("Edit the mask of "+column))
+}
+
+// columnPort returns the DOT port of the row of a column in its table node.
+func columnPort(column string) string {
+	return "col_" + strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, column)
+}
+
 // generateTableNode creates the DOT representation for a single table, including masking info.
 func generateTableNode(
 	uniqueNodeID string,
@@ -233,13 +349,16 @@ func generateTableNode(
 	targetColumns map[string]Column,
 	sourceMetricsHeader string,
 	targetMetricsHeader string,
-	targetAnalysis map[string]AnalyzeColumn) string {
+	targetAnalysis map[string]AnalyzeColumn,
+	rankLabel string,
+	expanded map[string]bool) string {
 	maskingRules := make(map[string]maskInfo)
+	fieldRules := make(map[string][]maskInfo)
 	hasMasking := masking != nil
 	hasAnalysis := len(analysis) > 0
 
-	header := generateNodeHeader(table.Name, hasMasking, hasAnalysis, sourceMetricsHeader, targetMetricsHeader)
-	populateMaskingRules(masking, maskingRules)
+	header := generateNodeHeader(table.Name, rankLabel, hasMasking, hasAnalysis, sourceMetricsHeader, targetMetricsHeader)
+	populateMaskingRules(masking, maskingRules, fieldRules)
 
 	var rows strings.Builder
 	keyMap := make(map[string]bool)
@@ -268,22 +387,15 @@ func generateTableNode(
 			exportCell = fmt.Sprintf(`<TD ALIGN="LEFT"><FONT POINT-SIZE="9">%s</FONT></TD>`, col.Export)
 		}
 		row := fmt.Sprintf(`
-		<TR><TD ALIGN="LEFT"><B>%s%s</B></TD>%s`, keySymbol, col.Name, exportCell)
+		<TR><TD ALIGN="LEFT" PORT="%s"><B>%s%s</B></TD>%s`, columnPort(col.Name), keySymbol, col.Name, exportCell)
 
 		if hasMasking {
+			// The mask cells edit the mask of the column.
+			maskLink := maskEditLink(table.Name, folderName, col.Name)
 			if mask, ok := maskingRules[col.Name]; ok {
-				maskDisplay := mask.maskType
-				if strings.Contains(mask.maskType, "random") {
-					maskDisplay = "&#127922; " // Dice emoji
-				} else if strings.Contains(mask.maskType, "incremental") {
-					maskDisplay = "&#10133;  " // Use plus symbols as fallback
-				} else if strings.Contains(mask.maskType, "regex") {
-					maskDisplay = "&#128291; " // Language emoji
-				}
-				row += fmt.Sprintf(
-					`<TD ALIGN="CENTER"><FONT POINT-SIZE="10">%s</FONT></TD><TD ALIGN="LEFT"><FONT POINT-SIZE="10">%s</FONT></TD>`, maskDisplay, mask.maskValue)
+				row += generateMaskCells(mask, maskLink)
 			} else {
-				row += "<TD></TD><TD></TD>"
+				row += fmt.Sprintf("<TD%s></TD><TD%s></TD>", maskLink, maskLink)
 			}
 		}
 		if hasAnalysis && hasMasking {
@@ -313,6 +425,36 @@ func generateTableNode(
 			}
 		}
 		rows.WriteString(row + "</TR>")
+
+		// Masks of JSON sub-fields, in rows under their column behind a toggle row, collapsed by default.
+		if len(fieldRules[col.Name]) == 0 {
+			continue
+		}
+		isExpanded := expanded[table.Name+"."+col.Name]
+		toggle, tooltip := "&#9656;", "Show the masks of its sub-fields"
+		if isExpanded {
+			toggle, tooltip = "&#9662;", "Hide the masks of its sub-fields"
+		}
+		toggleLink := html.EscapeString(fmt.Sprintf("javascript:toggleFields(%s, %s)", jsString(table.Name), jsString(col.Name)))
+		row = fmt.Sprintf(`
+		<TR><TD ALIGN="LEFT" HREF="%s" TOOLTIP="%s"><FONT POINT-SIZE="10">%s %d masked sub-fields</FONT></TD><TD></TD><TD></TD><TD></TD>`, toggleLink, tooltip, toggle, len(fieldRules[col.Name]))
+		if hasAnalysis {
+			row += "<TD></TD><TD></TD>"
+		}
+		rows.WriteString(row + "</TR>")
+		if !isExpanded {
+			continue
+		}
+		for _, mask := range fieldRules[col.Name] {
+			path := selectorPath(col.Name, mask.field)
+			maskLink := maskEditLink(table.Name, folderName, path)
+			row := fmt.Sprintf(`
+		<TR><TD ALIGN="LEFT"><FONT POINT-SIZE="10">&#8627; %s</FONT></TD><TD></TD>%s`, html.EscapeString(mask.field), generateMaskCells(mask, maskLink))
+			if hasAnalysis {
+				row += "<TD></TD><TD></TD>"
+			}
+			rows.WriteString(row + "</TR>")
+		}
 	}
 
 	return fmt.Sprintf(`
@@ -330,8 +472,28 @@ func generateTableNode(
 `, uniqueNodeID, table.Name, folderName, header, rows.String())
 }
 
-// populateMaskingRules extracts masking rule information from a masking.
-func populateMaskingRules(masking *MaskingSchema, maskingRules map[string]maskInfo) {
+// generateMaskCells creates the two cells showing the type and the value of a mask.
+func generateMaskCells(mask maskInfo, maskLink string) string {
+	maskDisplay := mask.maskType
+	if strings.Contains(mask.maskType, "random") {
+		maskDisplay = "&#127922; " // Dice emoji
+	} else if strings.Contains(mask.maskType, "incremental") {
+		maskDisplay = "&#10133;  " // Use plus symbols as fallback
+	} else if strings.Contains(mask.maskType, "regex") {
+		maskDisplay = "&#128291; " // Language emoji
+	}
+	return fmt.Sprintf(
+		`<TD ALIGN="CENTER"%s><FONT POINT-SIZE="10">%s</FONT></TD><TD ALIGN="LEFT"%s><FONT POINT-SIZE="10">%s</FONT></TD>`, maskLink, maskDisplay, maskLink, mask.maskValue)
+}
+
+// escapeDotString escapes a text for a double-quoted DOT attribute.
+func escapeDotString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// populateMaskingRules extracts masking rule information from a masking, keyed by column.
+// The rules of JSON sub-fields are gathered under their column in fieldRules, in file order.
+func populateMaskingRules(masking *MaskingSchema, maskingRules map[string]maskInfo, fieldRules map[string][]maskInfo) {
 	if masking == nil {
 		return
 	}
@@ -345,20 +507,31 @@ func populateMaskingRules(masking *MaskingSchema, maskingRules map[string]maskIn
 			mType, mValue = "incremental", fmt.Sprintf("start=%d, step=%d", rule.Mask.Incremental.Start, rule.Mask.Incremental.Increment)
 		} else if len(rule.Masks) > 0 {
 			mType, mValue = "multiple", "see masking"
+		} else if masks := rule.pimoMasks(); len(masks) > 0 {
+			for kind := range masks[0] {
+				mType = kind // Any other PIMO mask, e.g. ff1
+			}
 		}
 		// Only add the rule if a mask type was actually found.
-		if mType != "" {
-			maskingRules[rule.Selector.Jsonpath] = maskInfo{maskType: mType, maskValue: mValue}
+		if mType == "" {
+			continue
+		}
+		column, field := rule.selector()
+		if field != "" {
+			fieldRules[column] = append(fieldRules[column], maskInfo{field: field, maskType: mType, maskValue: mValue})
+		} else {
+			maskingRules[column] = maskInfo{maskType: mType, maskValue: mValue}
 		}
 	}
 }
 
 // generateNodeHeader creates the HTML-like string for a table node's header row.
-func generateNodeHeader(tableName string, hasMasking, hasAnalysis bool, sourceMetrics, targetMetrics string) string {
+// The rank label, when not empty, shows the load order of the table before its name.
+func generateNodeHeader(tableName, rankLabel string, hasMasking, hasAnalysis bool, sourceMetrics, targetMetrics string) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf(`
 		<TR>
-			<TD BGCOLOR="olive" COLSPAN="2" CELLPADDING="4" ><FONT COLOR="white" POINT-SIZE="20"><B>%s</B></FONT></TD>`, tableName))
+			<TD BGCOLOR="olive" COLSPAN="2" CELLPADDING="4" ><FONT COLOR="white" POINT-SIZE="20">%s<B>%s</B></FONT></TD>`, rankLabel, tableName))
 
 	if hasMasking {
 		sb.WriteString(`
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	CONTENT_TYPE_JSONL  = "application/x-ndjson"
+	SAMPLE_ROWS_DEFAULT = 20
+	SAMPLE_ROWS_MAX     = 1000
+)
+
+// sampleColumn generates the values of a column of synthetic rows.
+type sampleColumn struct {
+	name      string
+	kind      string // numeric, datetime, bool or string
+	metric    AnalyzeColumn
+	key       bool // Values are unique
+	nullRatio float64
+	emptyRate float64
+	seen      map[string]bool
+	next      int64 // Next value of an integer key
+}
+
+// newSampleColumn prepares the generation of a column from its export type and analyze metrics.
+// A foreign key takes its values in the range of the key it references.
+func newSampleColumn(folder *FolderData, metrics map[string]map[string]AnalyzeColumn, table Table, col Column) *sampleColumn {
+	c := &sampleColumn{name: col.Name, kind: col.Export, seen: map[string]bool{}, next: 1}
+	role, keyTable, keyColumn := columnRole(table, folder.Relations.Relations, col.Name)
+	c.metric = metrics[table.Name][col.Name]
+	if keyMetric, ok := metrics[keyTable][keyColumn]; role == ROLE_FOREIGN_KEY && ok {
+		c.metric = keyMetric
+	}
+	c.key = role == ROLE_KEY
+	if c.metric.Type != "" {
+		c.kind = c.metric.Type
+	}
+	if count := c.metric.MainMetric.Count; count > 0 && !c.key {
+		c.nullRatio = float64(c.metric.MainMetric.Nulls) / float64(count)
+		c.emptyRate = float64(c.metric.MainMetric.Empty) / float64(count)
+	}
+	if min, _, integer, ranged := numericRange(c.metric); c.key && integer && ranged {
+		c.next = int64(min)
+	}
+	return c
+}
+
+// value generates the value of the column for a new row. Keys never repeat a value.
+func (c *sampleColumn) value(rng *rand.Rand) interface{} {
+	if c.nullRatio > 0 && rng.Float64() < c.nullRatio {
+		return nil
+	}
+	if c.key && (c.kind == "numeric" || c.kind == "") && !c.hasSamples(uuidPattern.MatchString) {
+		c.next++
+		return c.next - 1
+	}
+	for attempt := 0; ; attempt++ {
+		value := c.random(rng)
+		if !c.key {
+			return value
+		}
+		text := fmt.Sprint(value)
+		if attempt >= 10 {
+			text = fmt.Sprintf("%s%d", text, len(c.seen)) // Make it unique, whatever its shape
+			value = text
+		}
+		if !c.seen[text] {
+			c.seen[text] = true
+			return value
+		}
+	}
+}
+
+// hasSamples tells whether the column has analyzed samples, all satisfying a predicate.
+func (c *sampleColumn) hasSamples(predicate func(string) bool) bool {
+	samples := sampleStrings(c.metric.MainMetric.Samples)
+	return len(samples) > 0 && allMatch(samples, predicate)
+}
+
+// random generates a value following the metrics of the column.
+func (c *sampleColumn) random(rng *rand.Rand) interface{} {
+	samples := sampleStrings(c.metric.MainMetric.Samples)
+	min, max, integer, ranged := numericRange(c.metric)
+	switch {
+	case c.hasSamples(uuidPattern.MatchString):
+		return randomUUID(rng)
+	case c.kind == "numeric" && ranged && integer && max-min < 1<<62:
+		return int64(min) + randomUpTo(rng, int64(max-min))
+	case c.kind == "numeric" && ranged:
+		return math.Round((min+rng.Float64()*(max-min))*100) / 100
+	case c.kind == "numeric":
+		return rng.Int64N(1000) + 1
+	case c.kind == "bool":
+		return rng.IntN(2) == 1
+	case c.kind == "datetime" || c.hasSamples(isDate):
+		from, to := dateRange(c.metric, samples)
+		date := from.Add(time.Duration(randomUpTo(rng, int64(to.Sub(from)))))
+		return date.Format(sampleDateLayout(samples))
+	case c.emptyRate > 0 && rng.Float64() < c.emptyRate:
+		return ""
+	case len(samples) > 0:
+		return shapeLike(samples[rng.IntN(len(samples))], rng)
+	}
+	return randomLetters(c.length(rng), rng)
+}
+
+// randomUpTo draws an integer between 0 and n included, or 0 when n is negative.
+func randomUpTo(rng *rand.Rand, n int64) int64 {
+	switch {
+	case n <= 0:
+		return 0
+	case n == math.MaxInt64:
+		return rng.Int64()
+	}
+	return rng.Int64N(n + 1)
+}
+
+// length draws a length from the analyzed length distribution, or between the min and max lengths.
+func (c *sampleColumn) length(rng *rand.Rand) int {
+	metric := c.metric.StringMetric
+	draw := rng.Float64()
+	for _, length := range metric.Lengths {
+		if draw -= length.Freq; draw < 0 {
+			return length.Length
+		}
+	}
+	if metric.MaxLen > 0 {
+		return metric.MinLen + rng.IntN(metric.MaxLen-metric.MinLen+1)
+	}
+	return 8
+}
+
+// shapeLike generates a value of the same format as a sample: each digit or letter is replaced by
+// a random one of the same class, other characters are kept. Samples are never copied as is.
+func shapeLike(sample string, rng *rand.Rand) string {
+	runes := []rune(sample)
+	for i, r := range runes {
+		switch charClass(r) {
+		case "[0-9]":
+			runes[i] = rune('0' + rng.IntN(10))
+		case "[a-z]":
+			runes[i] = rune('a' + rng.IntN(26))
+		case "[A-Z]":
+			runes[i] = rune('A' + rng.IntN(26))
+		}
+	}
+	return string(runes)
+}
+
+// randomLetters generates a lower case word.
+func randomLetters(n int, rng *rand.Rand) string {
+	letters := make([]byte, n)
+	for i := range letters {
+		letters[i] = byte('a' + rng.IntN(26))
+	}
+	return string(letters)
+}
+
+// randomUUID generates a version 4 UUID.
+func randomUUID(rng *rand.Rand) string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(rng.IntN(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// sampleDateLayout returns the layout of the analyzed dates, RFC 3339 by default.
+func sampleDateLayout(samples []string) string {
+	for _, sample := range samples {
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, sample); err == nil {
+				return layout
+			}
+		}
+	}
+	return time.RFC3339
+}
+
+// generateSampleRows renders n synthetic rows of a table as JSON lines, the columns in table order.
+func generateSampleRows(folder *FolderData, table Table, n int, rng *rand.Rand) ([]byte, error) {
+	metrics := make(map[string]map[string]AnalyzeColumn)
+	for _, analyzed := range folder.Analysis.Tables {
+		metrics[analyzed.Name] = make(map[string]AnalyzeColumn)
+		for _, col := range analyzed.Columns {
+			metrics[analyzed.Name][col.Name] = col
+		}
+	}
+	columns := make([]*sampleColumn, len(table.Columns))
+	for i, col := range table.Columns {
+		columns[i] = newSampleColumn(folder, metrics, table, col)
+	}
+
+	var buf bytes.Buffer
+	for row := 0; row < n; row++ {
+		buf.WriteByte('{')
+		for i, col := range columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(col.name)
+			value, err := json.Marshal(col.value(rng))
+			if err != nil {
+				return nil, fmt.Errorf("column '%s': %w", col.name, err)
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// sampleRowsHandler serves synthetic rows of a table as JSON lines, the input of a masking without database.
+// The number of rows is given by ?n= (20 by default), and ?seed= makes the rows reproducible.
+func sampleRowsHandler(store *ProjectStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		tableName := chi.URLParam(r, "table")
+		n := SAMPLE_ROWS_DEFAULT
+		if value := r.URL.Query().Get("n"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > SAMPLE_ROWS_MAX {
+				http.Error(w, fmt.Sprintf("n must be a number of rows between 1 and %d", SAMPLE_ROWS_MAX), http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
+		seed := uint64(time.Now().UnixNano())
+		if value := r.URL.Query().Get("seed"); value != "" {
+			parsed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				http.Error(w, "seed must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			seed = parsed
+		}
+
+		snap := store.Snapshot()
+		tableFolder, table, err := findTableLocation(snap.Data, tableName, folderName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		rows, err := generateSampleRows(snap.Data[tableFolder], *table, n, rand.New(rand.NewPCG(seed, seed)))
+		if err != nil {
+			log.Printf("Failed to generate sample rows of '%s': %v", tableName, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSONL)
+		w.Write(rows)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SQLITE_HEADER    = "SQLite format 3\x00"
+	SQLITE_MAX_DEPTH = 64 // Deepest b-tree walked, deeper ones being corrupt
+)
+
+// SQLITE_SUFFIXES are the extensions of the SQLite databases read as a data source.
+var SQLITE_SUFFIXES = []string{".db", ".sqlite", ".sqlite3"}
+
+// B-tree page types of the SQLite file format.
+const (
+	SQLITE_INTERIOR_INDEX = 0x02
+	SQLITE_INTERIOR_TABLE = 0x05
+	SQLITE_LEAF_INDEX     = 0x0a
+	SQLITE_LEAF_TABLE     = 0x0d
+)
+
+// SQLiteSchema is what a SQLite database gives to its folder: the tables and relations lino would extract
+// from it, and the metrics lino analyse would compute.
+type SQLiteSchema struct {
+	Tables    []Table
+	Relations RelationSchema
+	Analysis  AnalyzeSchema
+	Warnings  []string
+}
+
+// sqliteFile reads the pages of a SQLite database file, see https://www.sqlite.org/fileformat.html.
+// Changes still in a write-ahead log (-wal file) are not read.
+type sqliteFile struct {
+	data     []byte
+	pageSize int
+	usable   int // Page size without the reserved bytes at the end of each page
+	utf16    binary.ByteOrder
+}
+
+// openSQLite checks the header of a database file.
+func openSQLite(data []byte) (*sqliteFile, error) {
+	if len(data) < 100 || string(data[:16]) != SQLITE_HEADER {
+		return nil, errors.New("not a SQLite 3 database")
+	}
+	f := &sqliteFile{data: data, pageSize: int(binary.BigEndian.Uint16(data[16:]))}
+	if f.pageSize == 1 {
+		f.pageSize = 65536
+	}
+	if f.pageSize < 512 || f.pageSize&(f.pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d", f.pageSize)
+	}
+	f.usable = f.pageSize - int(data[20])
+	switch binary.BigEndian.Uint32(data[56:]) {
+	case 2:
+		f.utf16 = binary.LittleEndian
+	case 3:
+		f.utf16 = binary.BigEndian
+	}
+	return f, nil
+}
+
+// page returns the content of a page, numbered from 1.
+func (f *sqliteFile) page(number uint32) ([]byte, error) {
+	start := int64(number-1) * int64(f.pageSize)
+	if number == 0 || start+int64(f.pageSize) > int64(len(f.data)) {
+		return nil, fmt.Errorf("page %d is out of the file", number)
+	}
+	return f.data[start : start+int64(f.pageSize)], nil
+}
+
+// sqliteVarint decodes a variable-length integer, returning it and the number of bytes read, 0 when truncated.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// walk calls visit with the payload of every cell of the b-tree rooted at a page, in key order,
+// with the rowid of table b-trees. The payloads of index b-trees are whole rows for WITHOUT ROWID tables.
+func (f *sqliteFile) walk(root uint32, depth int, visit func(rowid int64, payload []byte) error) error {
+	if depth > SQLITE_MAX_DEPTH {
+		return fmt.Errorf("b-tree deeper than %d pages at page %d", SQLITE_MAX_DEPTH, root)
+	}
+	page, err := f.page(root)
+	if err != nil {
+		return err
+	}
+	header := 0
+	if root == 1 {
+		header = 100 // The database header precedes the first page.
+	}
+	kind := page[header]
+	cellCount := int(binary.BigEndian.Uint16(page[header+3:]))
+	pointers := header + 8
+	if kind == SQLITE_INTERIOR_TABLE || kind == SQLITE_INTERIOR_INDEX {
+		pointers = header + 12
+	}
+	if pointers+2*cellCount > len(page) {
+		return fmt.Errorf("page %d has too many cells", root)
+	}
+
+	for i := 0; i < cellCount; i++ {
+		offset := int(binary.BigEndian.Uint16(page[pointers+2*i:]))
+		if offset >= len(page) {
+			return fmt.Errorf("page %d: cell out of the page", root)
+		}
+		cell := page[offset:]
+		if kind == SQLITE_INTERIOR_TABLE || kind == SQLITE_INTERIOR_INDEX {
+			if len(cell) < 4 {
+				return fmt.Errorf("page %d: truncated cell", root)
+			}
+			if err := f.walk(binary.BigEndian.Uint32(cell), depth+1, visit); err != nil {
+				return err
+			}
+			cell = cell[4:]
+		}
+		switch kind {
+		case SQLITE_INTERIOR_TABLE:
+			continue // Only holds the rowid separating its children.
+		case SQLITE_LEAF_TABLE:
+			size, n := sqliteVarint(cell)
+			id, m := sqliteVarint(cell[n:])
+			if n == 0 || m == 0 {
+				return fmt.Errorf("page %d: truncated cell", root)
+			}
+			payload, err := f.payload(cell[n+m:], size, f.usable-35)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", root, err)
+			}
+			if err := visit(int64(id), payload); err != nil {
+				return err
+			}
+		case SQLITE_LEAF_INDEX, SQLITE_INTERIOR_INDEX:
+			size, n := sqliteVarint(cell)
+			if n == 0 {
+				return fmt.Errorf("page %d: truncated cell", root)
+			}
+			payload, err := f.payload(cell[n:], size, (f.usable-12)*64/255-23)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", root, err)
+			}
+			if err := visit(0, payload); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("page %d is not a b-tree page", root)
+		}
+	}
+	if kind == SQLITE_INTERIOR_TABLE || kind == SQLITE_INTERIOR_INDEX {
+		return f.walk(binary.BigEndian.Uint32(page[header+8:]), depth+1, visit)
+	}
+	return nil
+}
+
+// payload returns the payload of a cell, reading the overflow pages of those larger than maxLocal bytes.
+func (f *sqliteFile) payload(cell []byte, size uint64, maxLocal int) ([]byte, error) {
+	if size <= uint64(maxLocal) {
+		if size > uint64(len(cell)) {
+			return nil, errors.New("truncated payload")
+		}
+		return cell[:size], nil
+	}
+	minLocal := (f.usable-12)*32/255 - 23
+	local := minLocal + int((size-uint64(minLocal))%uint64(f.usable-4))
+	if local > maxLocal {
+		local = minLocal
+	}
+	if local+4 > len(cell) {
+		return nil, errors.New("truncated payload")
+	}
+	payload := append([]byte{}, cell[:local]...)
+	next := binary.BigEndian.Uint32(cell[local:])
+	for pages := 0; uint64(len(payload)) < size; pages++ {
+		if next == 0 || pages > len(f.data)/f.pageSize {
+			return nil, errors.New("broken overflow chain")
+		}
+		page, err := f.page(next)
+		if err != nil {
+			return nil, err
+		}
+		chunk := min(uint64(f.usable-4), size-uint64(len(payload)))
+		payload = append(payload, page[4:4+chunk]...)
+		next = binary.BigEndian.Uint32(page)
+	}
+	return payload, nil
+}
+
+// record decodes the values of a row: nil, int64, float64, string or []byte.
+func (f *sqliteFile) record(payload []byte) ([]interface{}, error) {
+	headerSize, n := sqliteVarint(payload)
+	if n == 0 || headerSize > uint64(len(payload)) {
+		return nil, errors.New("invalid record header")
+	}
+	types := []uint64{}
+	for position := n; position < int(headerSize); {
+		serialType, m := sqliteVarint(payload[position:headerSize])
+		if m == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		types = append(types, serialType)
+		position += m
+	}
+
+	values := make([]interface{}, 0, len(types))
+	body := payload[headerSize:]
+	for _, serialType := range types {
+		size := sqliteValueSize(serialType)
+		if size > len(body) {
+			return nil, errors.New("truncated record")
+		}
+		value := body[:size]
+		body = body[size:]
+		switch {
+		case serialType == 0:
+			values = append(values, nil)
+		case serialType <= 6:
+			v := int64(int8(value[0])) // Sign extended big-endian integer
+			for _, b := range value[1:] {
+				v = v<<8 | int64(b)
+			}
+			values = append(values, v)
+		case serialType == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(value)))
+		case serialType == 8 || serialType == 9:
+			values = append(values, int64(serialType-8))
+		case serialType >= 12 && serialType%2 == 0:
+			values = append(values, append([]byte{}, value...))
+		case serialType >= 13:
+			values = append(values, f.text(value))
+		default:
+			return nil, fmt.Errorf("reserved serial type %d", serialType)
+		}
+	}
+	return values, nil
+}
+
+// sqliteValueSize returns the size in bytes of a value of a serial type.
+func sqliteValueSize(serialType uint64) int {
+	switch {
+	case serialType <= 4:
+		return int(serialType)
+	case serialType == 5:
+		return 6
+	case serialType == 6 || serialType == 7:
+		return 8
+	case serialType >= 12:
+		return int((serialType - 12) / 2)
+	}
+	return 0
+}
+
+// text decodes a string in the text encoding of the database.
+func (f *sqliteFile) text(value []byte) string {
+	if f.utf16 == nil {
+		return string(value)
+	}
+	units := make([]uint16, len(value)/2)
+	for i := range units {
+		units[i] = f.utf16.Uint16(value[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// sqliteExportType maps a declared column type to an export type, following the type affinity
+// of SQLite when the type is not one of the other databases: any type containing INT is an integer.
+func sqliteExportType(sqlType string) string {
+	export := ddlExportType(sqlType)
+	if export == "string" && strings.Contains(sqlType, "int") {
+		return "numeric"
+	}
+	return export
+}
+
+// readSQLite reads the tables, relations and metrics of a SQLite database: the schema from the CREATE TABLE
+// statements it stores, the metrics from all the rows of its tables.
+func readSQLite(name string, data []byte) (*SQLiteSchema, error) {
+	f, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Page 1 is the root of the sqlite_schema table: type, name, tbl_name, rootpage, sql.
+	rootPages := map[string]uint32{}
+	statements := []string{}
+	err = f.walk(1, 0, func(_ int64, payload []byte) error {
+		row, err := f.record(payload)
+		if err != nil {
+			return fmt.Errorf("sqlite_schema: %w", err)
+		}
+		if len(row) < 5 || row[0] != "table" {
+			return nil
+		}
+		name, _ := row[1].(string)
+		rootPage, _ := row[3].(int64)
+		sql, _ := row[4].(string)
+		if strings.HasPrefix(name, "sqlite_") || rootPage == 0 { // Internal and virtual tables
+			return nil
+		}
+		rootPages[strings.ToLower(name)] = uint32(rootPage)
+		statements = append(statements, sql)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ddl := ParseDDL(strings.Join(statements, ";\n"))
+	for i := range ddl.tables {
+		for j := range ddl.tables[i].columns {
+			ddl.tables[i].columns[j].Export = sqliteExportType(ddl.tables[i].types[j])
+		}
+	}
+	schema := &SQLiteSchema{
+		Tables:    ddl.Tables(),
+		Relations: RelationSchema{Version: "v1"},
+		Warnings:  ddl.Warnings,
+	}
+	for _, relation := range ddl.relations {
+		schema.Relations.Relations = append(schema.Relations.Relations, Relation{
+			Name:   relation.Name,
+			Parent: Table{Name: relation.Parent.Name, Keys: relation.Parent.Keys},
+			Child:  Table{Name: relation.Child.Name, Keys: relation.Child.Keys},
+		})
+	}
+
+	out := analyzeOutput{Database: strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), Tables: []analyzeTableOutput{}}
+	for _, table := range ddl.tables {
+		analyzed, err := f.analyzeTable(table, rootPages[strings.ToLower(table.name)])
+		if err != nil {
+			schema.Warnings = append(schema.Warnings, fmt.Sprintf("table '%s' not analyzed: %v", table.name, err))
+			continue
+		}
+		out.Tables = append(out.Tables, analyzed)
+	}
+	// The metrics take the same path as an analyze.yaml file.
+	content, err := yaml.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(content, &schema.Analysis); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// analyzeTable computes the metrics of the columns of a table from its rows.
+func (f *sqliteFile) analyzeTable(table *ddlTable, rootPage uint32) (analyzeTableOutput, error) {
+	columns := make([]*columnStats, len(table.columns))
+	for i, column := range table.columns {
+		columns[i] = &columnStats{name: column.Name, lengths: map[int]*valueStats{}}
+	}
+
+	// An INTEGER PRIMARY KEY column is the rowid, stored as null in the rows.
+	rowidColumn := -1
+	if len(table.keys) == 1 {
+		for i, column := range table.columns {
+			if strings.EqualFold(column.Name, table.keys[0]) && table.types[i] == "integer" {
+				rowidColumn = i
+			}
+		}
+	}
+	// WITHOUT ROWID tables are stored in an index b-tree, their primary key columns first.
+	order := make([]int, len(table.columns))
+	for i := range order {
+		order[i] = i
+	}
+	for i := range table.options {
+		if hasKeywords(table.options[i:], "WITHOUT", "ROWID") {
+			rowidColumn = -1
+			order = withoutRowidOrder(table)
+		}
+	}
+
+	rows := 0
+	err := f.walk(rootPage, 0, func(rowid int64, payload []byte) error {
+		values, err := f.record(payload)
+		if err != nil {
+			return err
+		}
+		rows++
+		for position, i := range order {
+			// Columns added later are missing from the older rows, which have their default value.
+			value := table.defaults[i]
+			if position < len(values) {
+				value = values[position]
+			}
+			if i == rowidColumn && value == nil {
+				value = rowid
+			}
+			if blob, ok := value.([]byte); ok {
+				value = base64.StdEncoding.EncodeToString(blob)
+			}
+			if value != nil {
+				columns[i].add(value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return analyzeTableOutput{}, err
+	}
+
+	out := analyzeTableOutput{Name: table.name, Columns: []analyzeColumnOutput{}}
+	for _, column := range columns {
+		out.Columns = append(out.Columns, column.output(rows))
+	}
+	return out, nil
+}
+
+// withoutRowidOrder returns the columns in the order a WITHOUT ROWID table stores them: its primary key, then the others.
+func withoutRowidOrder(table *ddlTable) []int {
+	order := []int{}
+	isKey := map[int]bool{}
+	for _, key := range table.keys {
+		for i, column := range table.columns {
+			if strings.EqualFold(column.Name, key) && !isKey[i] {
+				order = append(order, i)
+				isKey[i] = true
+			}
+		}
+	}
+	for i := range table.columns {
+		if !isKey[i] {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// hasSQLiteSuffix tells whether a file is named like a SQLite database.
+func hasSQLiteSuffix(name string) bool {
+	return slices.Contains(SQLITE_SUFFIXES, filepath.Ext(name))
+}
+
+// isSQLiteFile tells whether a file is a SQLite database read as a data source: named like one,
+// and starting with the SQLite header, unlike other .db files (Thumbs.db, BoltDB or Berkeley DB).
+func isSQLiteFile(path string) bool {
+	if !hasSQLiteSuffix(path) {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, len(SQLITE_HEADER))
+	_, err = io.ReadFull(file, header)
+	return err == nil && string(header) == SQLITE_HEADER
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// SQLITE_FIXTURE has 512 bytes pages, so that its b-trees have interior pages:
+//   - owners: an INTEGER PRIMARY KEY rowid alias (10 to 1010), and a country column added by
+//     ALTER TABLE with the default 'FR', missing from the 100 rows inserted before it ('BE' in the last one)
+//   - pets: a WITHOUT ROWID table of 150 rows, keyed by (code, owner_id), referencing owners
+//   - notes: a 10000 characters body spilling over overflow pages, and a blob
+const SQLITE_FIXTURE = "tests/sqlite/fixture.db"
+
+func readSQLiteFixture(t *testing.T) *SQLiteSchema {
+	t.Helper()
+	data, err := os.ReadFile(SQLITE_FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := readSQLite(SQLITE_FIXTURE, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestReadSQLiteTables(t *testing.T) {
+	schema := readSQLiteFixture(t)
+	wantTables := []Table{
+		{Name: "owners", Keys: []string{"id"}, Columns: []Column{{Name: "id", Export: "numeric"}, {Name: "name", Export: "string"}, {Name: "country", Export: "string"}}},
+		{Name: "pets", Keys: []string{"code", "owner_id"}, Columns: []Column{{Name: "owner_id", Export: "numeric"}, {Name: "code", Export: "string"}, {Name: "weight", Export: "numeric"}}},
+		{Name: "notes", Keys: []string{"id"}, Columns: []Column{{Name: "id", Export: "numeric"}, {Name: "body", Export: "string"}, {Name: "data", Export: "base64"}}},
+	}
+	if !reflect.DeepEqual(schema.Tables, wantTables) {
+		t.Errorf("tables:\n got %+v\nwant %+v", schema.Tables, wantTables)
+	}
+	wantRelations := []Relation{{
+		Name:   "fk_pets_owners",
+		Parent: Table{Name: "owners", Keys: []string{"id"}},
+		Child:  Table{Name: "pets", Keys: []string{"owner_id"}},
+	}}
+	if !reflect.DeepEqual(schema.Relations.Relations, wantRelations) {
+		t.Errorf("relations:\n got %+v\nwant %+v", schema.Relations.Relations, wantRelations)
+	}
+	if len(schema.Warnings) > 0 {
+		t.Errorf("warnings: %q", schema.Warnings)
+	}
+}
+
+func TestReadSQLiteMetrics(t *testing.T) {
+	schema := readSQLiteFixture(t)
+	metrics := map[string]AnalyzeColumn{}
+	for _, table := range schema.Analysis.Tables {
+		for _, column := range table.Columns {
+			metrics[table.Name+"."+column.Name] = column
+		}
+	}
+
+	// Expected values as computed by sqlite3 on the fixture.
+	tests := []struct {
+		column       string
+		count, nulls int
+		min, max     string
+	}{
+		{"owners.id", 101, 0, "10", "1010"},             // rowid alias, stored as null in the rows
+		{"owners.name", 101, 0, "owner001", "owner101"}, // across interior pages
+		{"owners.country", 101, 0, "BE", "FR"},          // default of the rows older than the column
+		{"pets.owner_id", 150, 0, "10", "1000"},         // WITHOUT ROWID, key columns stored first
+		{"pets.code", 150, 0, "P0000", "P0149"},
+		{"pets.weight", 150, 0, "1.5", "150.5"},
+		{"notes.data", 2, 1, "AAEC", "AAEC"}, // blob as base64
+	}
+	for _, test := range tests {
+		t.Run(test.column, func(t *testing.T) {
+			metric, ok := metrics[test.column]
+			if !ok {
+				t.Fatalf("column not analyzed")
+			}
+			main := metric.MainMetric
+			if main.Count != test.count || main.Nulls != test.nulls {
+				t.Errorf("count %d, nulls %d, want %d and %d", main.Count, main.Nulls, test.count, test.nulls)
+			}
+			if min, max := fmt.Sprint(main.Min), fmt.Sprint(main.Max); min != test.min || max != test.max {
+				t.Errorf("min %s, max %s, want %s and %s", min, max, test.min, test.max)
+			}
+		})
+	}
+
+	// The body of the first note spills over several overflow pages.
+	if body := metrics["notes.body"].StringMetric; body.MinLen != 5 || body.MaxLen != 10000 {
+		t.Errorf("notes.body lengths %d to %d, want 5 to 10000", body.MinLen, body.MaxLen)
+	}
+}
+
+func TestSQLiteOverflowPayload(t *testing.T) {
+	data, err := os.ReadFile(SQLITE_FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := openSQLite(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rootPage int64
+	err = f.walk(1, 0, func(_ int64, payload []byte) error {
+		row, err := f.record(payload)
+		if err == nil && len(row) >= 5 && row[1] == "notes" {
+			rootPage, _ = row[3].(int64)
+		}
+		return err
+	})
+	if err != nil || rootPage == 0 {
+		t.Fatalf("notes not found in sqlite_schema: %v", err)
+	}
+
+	bodies := map[int64]interface{}{}
+	err = f.walk(uint32(rootPage), 0, func(rowid int64, payload []byte) error {
+		row, err := f.record(payload)
+		if err == nil {
+			bodies[rowid] = row[1]
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("abcdefghij", 1000); bodies[1] != want {
+		t.Errorf("overflowing body of %d characters, not the one written", len(fmt.Sprint(bodies[1])))
+	}
+	if bodies[2] != "short" {
+		t.Errorf("body %v, want short", bodies[2])
+	}
+}
+
+func TestIsSQLiteFile(t *testing.T) {
+	dir := t.TempDir()
+	thumbs := filepath.Join(dir, "Thumbs.db")
+	if err := os.WriteFile(thumbs, []byte("\xd0\xcf\x11\xe0 not a SQLite database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if isSQLiteFile(thumbs) {
+		t.Errorf("%s is not a SQLite database", thumbs)
+	}
+	if !isSQLiteFile(SQLITE_FIXTURE) {
+		t.Errorf("%s is a SQLite database", SQLITE_FIXTURE)
+	}
+	files, err := findSchemaFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) > 0 {
+		t.Errorf("found %v, want no schema file", files)
+	}
+}
+
+func TestSQLiteWithGeneratedYAML(t *testing.T) {
+	root := t.TempDir()
+	data, err := os.ReadFile(SQLITE_FIXTURE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both analyze files belong to the app folder: the last one replaces the other, unlike the database.
+	analysis := "database: source\ntables:\n  - name: owners\n    columns:\n      - name: id\n        type: numeric\n"
+	files := map[string]string{
+		"app/app.db":              string(data),
+		"app/tables.yaml":         "version: v1\ntables:\n  - name: owners\n    keys: [id]\n    columns:\n      - name: id\n        export: string\n",
+		"app/relations.yaml":      "version: v1\nrelations:\n  - name: fk_pets_owners\n    parent: {name: owners, keys: [id]}\n    child: {name: pets, keys: [owner_id]}\n",
+		"app/analyze.yaml":        analysis,
+		"app/source/analyze.yaml": analysis,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileMap, err := findSchemaFiles([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectData, _ := inferAllSchemas(fileMap)
+	folder := projectData["app"]
+
+	tables := []string{}
+	for _, table := range folder.Tables {
+		tables = append(tables, table.Name)
+	}
+	if want := []string{"owners", "pets", "notes"}; !reflect.DeepEqual(tables, want) {
+		t.Errorf("tables %v, want %v", tables, want)
+	}
+	if export := folder.Tables[0].Columns[0].Export; export != "string" {
+		t.Errorf("owners.id exported as %s, tables.yaml must take precedence", export)
+	}
+	if len(folder.Relations.Relations) != 1 {
+		t.Errorf("relations %+v, want fk_pets_owners once", folder.Relations.Relations)
+	}
+	analyzed := []string{}
+	for _, table := range folder.Analysis.Tables {
+		analyzed = append(analyzed, table.Name)
+	}
+	if want := []string{"owners", "pets", "notes"}; !reflect.DeepEqual(analyzed, want) {
+		t.Errorf("analyzed tables %v, want %v", analyzed, want)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// projectSnapshot is an immutable view of the parsed project at a given revision.
+// Handlers must treat Data and FileMap as read-only: a reload always builds new ones.
+type projectSnapshot struct {
+	Data     ProjectData
+	FileMap  map[string]string     // YAML file path -> input path it was found in
+	Revision uint64                // Incremented each time the content hash changes
+	Hash     string                // sha256 of every parsed file path and content
+	Files    map[string]FileStatus // Parse result of every YAML file, keyed by absolute path
+}
+
+// ETag returns the HTTP entity tag identifying this snapshot.
+func (snap *projectSnapshot) ETag() string {
+	return fmt.Sprintf(`"r%d-%s"`, snap.Revision, snap.Hash[:16])
+}
+
+// ProjectStore holds the current project snapshot and replaces it atomically on reload.
+// Readers never lock: they grab the current snapshot once and work on it.
+type ProjectStore struct {
+	inputPaths []string
+	mu         sync.Mutex   // Serializes reloads so revisions are never skipped nor duplicated.
+	cache      *schemaCache // Parsed files, only re-parsed when they change. Guarded by mu.
+	current    atomic.Pointer[projectSnapshot]
+	hub        *eventHub // Optional, notified of every new revision.
+}
+
+// newProjectStore parses the files of fileMap into the first revision of the project.
+func newProjectStore(inputPaths []string, fileMap map[string]string) *ProjectStore {
+	ps := &ProjectStore{inputPaths: inputPaths, cache: newSchemaCache()}
+	projectData, _ := ps.cache.update(fileMap, nil)
+	ps.current.Store(&projectSnapshot{
+		Data:     projectData,
+		FileMap:  fileMap,
+		Revision: 1,
+		Hash:     ps.cache.hash(),
+		Files:    ps.cache.statuses(),
+	})
+	return ps
+}
+
+// Snapshot returns the current project snapshot.
+func (ps *ProjectStore) Snapshot() *projectSnapshot {
+	return ps.current.Load()
+}
+
+// Reload finds all YAML files, re-parses the changed ones and publishes a new snapshot.
+// The revision only moves forward when some file changed, in which case
+// a project-changed event listing the changed files is published.
+func (ps *ProjectStore) Reload() (*projectSnapshot, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	fileMap, err := findSchemaFiles(ps.inputPaths)
+	if err != nil {
+		return nil, fmt.Errorf("error finding YAML files during reload: %w", err)
+	}
+	previous := ps.current.Load()
+	projectData, changed := ps.cache.update(fileMap, previous.Data)
+	if len(changed) == 0 {
+		log.Printf("Schemas unchanged, keeping revision %d.", previous.Revision)
+		return previous, nil
+	}
+
+	snap := &projectSnapshot{
+		Data:     projectData,
+		FileMap:  fileMap,
+		Revision: previous.Revision + 1,
+		Hash:     ps.cache.hash(),
+		Files:    ps.cache.statuses(),
+	}
+	ps.current.Store(snap)
+	log.Printf("Successfully reloaded schemas, revision %d (%d changed files).", snap.Revision, len(changed))
+
+	if ps.hub != nil {
+		ps.hub.publish(ProjectEvent{
+			Type:     EVENT_PROJECT_CHANGED,
+			Revision: snap.Revision,
+			ETag:     snap.ETag(),
+			Files:    changed,
+		})
+	}
+	return snap, nil
+}
+
+// checkNotModified sets the ETag header for the snapshot and answers 304 Not Modified
+// when the client already holds this revision. It returns true if the response is complete.
+func checkNotModified(w http.ResponseWriter, r *http.Request, snap *projectSnapshot) bool {
+	etag := snap.ETag()
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache") // Always revalidate, the ETag makes it cheap.
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if candidate = strings.TrimSpace(candidate); candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Roles of a column in its table, deciding whether its mask must keep the relations consistent.
+const (
+	ROLE_KEY         = "key"
+	ROLE_FOREIGN_KEY = "foreign-key"
+	ROLE_DATA        = "data"
+)
+
+// FF1_KEY_ENV is the environment variable holding the encryption key of the suggested ff1 masks.
+const FF1_KEY_ENV = "FF1_ENCRYPTION_KEY"
+
+// Date range of the suggested randDate masks, when the column was not analyzed.
+var (
+	suggestDateMin = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	suggestDateMax = time.Date(2030, 12, 31, 0, 0, 0, 0, time.UTC)
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05", "2006-01-02"}
+
+	// nameHints map column names onto the PIMO dictionaries of realistic values.
+	nameHints = []struct {
+		pattern *regexp.Regexp
+		uri     string
+	}{
+		{regexp.MustCompile(`(?i)(first_?name|given_?name|prenom)`), "pimo://nameFR"},
+		{regexp.MustCompile(`(?i)(last_?name|surname|family_?name|^nom$)`), "pimo://surnameFR"},
+		{regexp.MustCompile(`(?i)(city|town|ville)`), "pimo://townFR"},
+	}
+)
+
+// MaskSuggestion is the PIMO mask proposed for a column.
+type MaskSuggestion struct {
+	Column string                 `json:"column"`
+	Role   string                 `json:"role"`            // ROLE_KEY, ROLE_FOREIGN_KEY or ROLE_DATA
+	Type   string                 `json:"type"`            // Analyzed type, or exported type when the column was not analyzed
+	Mask   map[string]interface{} `json:"mask,omitempty"`  // e.g. {"randomInt": {"min": 1, "max": 100}}, none without metrics
+	Cache  string                 `json:"cache,omitempty"` // Cache shared by a key and the foreign keys referencing it
+	Reason string                 `json:"reason"`
+}
+
+// MaskSuggestReport describes what writing the suggestions into a masking file changed.
+type MaskSuggestReport struct {
+	File    string   `json:"file"`
+	Created bool     `json:"created"` // The masking file did not exist yet
+	Applied []string `json:"applied"` // Columns whose empty mask got the suggestion
+	Skipped []string `json:"skipped"` // Columns already masked, or without suggestion
+}
+
+// columnRole tells whether a column is a key, a foreign key or plain data. Keys also return the key
+// they stand for: themselves, or the parent key of a foreign key. A column both key and foreign key follows its parent.
+func columnRole(table Table, relations []Relation, column string) (string, string, string) {
+	for _, relation := range relations {
+		if relation.Child.Name != table.Name {
+			continue
+		}
+		for i, key := range relation.Child.Keys {
+			if key == column && i < len(relation.Parent.Keys) {
+				return ROLE_FOREIGN_KEY, relation.Parent.Name, relation.Parent.Keys[i]
+			}
+		}
+	}
+	if slices.Contains(table.Keys, column) {
+		return ROLE_KEY, table.Name, column
+	}
+	return ROLE_DATA, "", ""
+}
+
+// suggestMasks proposes a mask for every column of a table, from the metrics of the folder analysis.
+func suggestMasks(folder *FolderData, table Table) []MaskSuggestion {
+	metrics := make(map[string]map[string]AnalyzeColumn)
+	for _, analyzed := range folder.Analysis.Tables {
+		metrics[analyzed.Name] = make(map[string]AnalyzeColumn)
+		for _, col := range analyzed.Columns {
+			metrics[analyzed.Name][col.Name] = col
+		}
+	}
+
+	suggestions := make([]MaskSuggestion, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		role, keyTable, keyColumn := columnRole(table, folder.Relations.Relations, col.Name)
+		metric, analyzed := metrics[table.Name][col.Name]
+		if role == ROLE_DATA {
+			suggestions = append(suggestions, suggestMask(col, role, "", metric, analyzed, "", metric))
+			continue
+		}
+		// A foreign key is masked like its parent key, to share the cache values: the kind of mask
+		// only depends on the type and metrics of the key, so that both always get the same mask.
+		keyType := col.Export
+		for _, parent := range folder.Tables {
+			if parent.Name == keyTable {
+				if key := tableColumn(parent, keyColumn); key != nil {
+					keyType = key.Export
+				}
+				break
+			}
+		}
+		keyMetric, keyAnalyzed := metrics[keyTable][keyColumn]
+		if keyAnalyzed && keyMetric.Type != "" {
+			keyType = keyMetric.Type
+		}
+		suggestions = append(suggestions, suggestMask(col, role, keyTable+"_"+keyColumn, metric, analyzed, keyType, keyMetric))
+	}
+	return suggestions
+}
+
+// suggestMask proposes a mask for a column. Keys get masks keeping the relations consistent:
+// a deterministic ff1 encryption, or a random value through a cache shared with the foreign keys,
+// chosen from the type and metrics of the key they stand for.
+func suggestMask(column Column, role, cache string, metric AnalyzeColumn, analyzed bool, keyType string, keyMetric AnalyzeColumn) MaskSuggestion {
+	s := MaskSuggestion{Column: column.Name, Role: role, Type: column.Export}
+	if analyzed && metric.Type != "" {
+		s.Type = metric.Type
+	}
+	samples := sampleStrings(metric.MainMetric.Samples)
+	min, max, integer, ranged := numericRange(metric)
+	keySamples := sampleStrings(keyMetric.MainMetric.Samples)
+	_, keyMax, _, keyRanged := numericRange(keyMetric)
+
+	switch {
+	case role != ROLE_DATA && len(keySamples) > 0 && allMatch(keySamples, uuidPattern.MatchString):
+		s.Mask, s.Cache = pimoMask("randomUUID", map[string]interface{}{}), cache
+		s.Reason = "UUID key, the cache gives its foreign keys the same new UUIDs"
+
+	case role != ROLE_DATA && keyType == "numeric":
+		high := 1000000
+		if keyRanged {
+			high = int(keyMax)*10 + 1000
+		}
+		s.Mask, s.Cache = pimoMask("randomInt", intRange{Min: 1, Max: high}), cache
+		s.Reason = "Numeric key, the unique cache keeps the values distinct and gives its foreign keys the same values"
+
+	case role != ROLE_DATA:
+		s.Mask = pimoMask("ff1", ff1Args{KeyFromEnv: FF1_KEY_ENV, Domain: sampleDomain(keySamples)})
+		s.Reason = "String key, ff1 encryption is deterministic so that its foreign keys get the same values"
+
+	case s.Type == "bool":
+		s.Mask = pimoMask("randomChoice", []interface{}{true, false})
+		s.Reason = "Boolean column"
+
+	case s.Type == "numeric" && ranged && integer:
+		s.Mask = pimoMask("randomInt", intRange{Min: int(min), Max: int(max)})
+		s.Reason = "Integers observed between the analyzed min and max"
+
+	case s.Type == "numeric" && ranged:
+		s.Mask = pimoMask("randomDecimal", decimalRange{Min: min, Max: max, Precision: 2})
+		s.Reason = "Decimals observed between the analyzed min and max"
+
+	case s.Type == "datetime" || (len(samples) > 0 && allMatch(samples, isDate)):
+		from, to := dateRange(metric, samples)
+		s.Mask = pimoMask("randDate", dateRangeArgs{DateMin: from, DateMax: to})
+		s.Reason = "Date column"
+
+	case s.Type == "numeric":
+		s.Reason = "Numeric column without analysis metrics, run lino analyse to get a suggestion"
+
+	case nameHint(column.Name) != "":
+		s.Mask = pimoMask("randomChoiceInUri", nameHint(column.Name))
+		s.Reason = "The column name designates a person or a place, realistic values come from a PIMO dictionary"
+
+	case len(samples) > 0 && allMatch(samples, func(v string) bool { return strings.Contains(v, "@") }):
+		s.Mask = pimoMask("regex", `[a-z]{3,10}\.[a-z]{3,10}@example\.com`)
+		s.Reason = "Email addresses, replaced by addresses of a reserved domain"
+
+	case len(samples) > 0:
+		s.Mask = pimoMask("regex", samplesRegex(samples, metric.StringMetric))
+		s.Reason = "Regular expression matching the format and lengths of the analyzed values"
+
+	case analyzed:
+		s.Reason = "Only null or empty values were analyzed"
+
+	default:
+		s.Reason = "No analysis metrics, run lino analyse to get a suggestion"
+	}
+	return s
+}
+
+// Arguments of the suggested PIMO masks, in the order of the PIMO documentation.
+type (
+	intRange struct {
+		Min int `yaml:"min" json:"min"`
+		Max int `yaml:"max" json:"max"`
+	}
+	decimalRange struct {
+		Min       float64 `yaml:"min" json:"min"`
+		Max       float64 `yaml:"max" json:"max"`
+		Precision int     `yaml:"precision" json:"precision"`
+	}
+	dateRangeArgs struct {
+		DateMin time.Time `yaml:"dateMin" json:"dateMin"`
+		DateMax time.Time `yaml:"dateMax" json:"dateMax"`
+	}
+	ff1Args struct {
+		KeyFromEnv string `yaml:"keyFromEnv" json:"keyFromEnv"`
+		Domain     string `yaml:"domain" json:"domain"`
+	}
+)
+
+// pimoMask builds a mask made of a single PIMO mask type.
+func pimoMask(maskType string, args interface{}) map[string]interface{} {
+	return map[string]interface{}{maskType: args}
+}
+
+// nameHint returns the PIMO dictionary matching a column name, or "".
+func nameHint(column string) string {
+	for _, hint := range nameHints {
+		if hint.pattern.MatchString(column) {
+			return hint.uri
+		}
+	}
+	return ""
+}
+
+// sampleStrings returns the non-empty analyzed samples as strings.
+func sampleStrings(samples []interface{}) []string {
+	values := make([]string, 0, len(samples))
+	for _, sample := range samples {
+		if sample == nil {
+			continue
+		}
+		if value := fmt.Sprint(sample); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// allMatch tells whether every value satisfies the predicate.
+func allMatch(values []string, predicate func(string) bool) bool {
+	for _, value := range values {
+		if !predicate(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDate parses the date formats lino exports.
+func parseDate(value string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isDate tells whether a value is a date.
+func isDate(value string) bool {
+	_, ok := parseDate(value)
+	return ok
+}
+
+// dateRange returns the analyzed min and max dates, the range of the samples which are dates, or the default range.
+func dateRange(metric AnalyzeColumn, samples []string) (time.Time, time.Time) {
+	from, fromOK := parseDate(fmt.Sprint(metric.MainMetric.Min))
+	to, toOK := parseDate(fmt.Sprint(metric.MainMetric.Max))
+	if fromOK && toOK {
+		return from, to
+	}
+	found := false
+	for _, sample := range samples {
+		t, ok := parseDate(sample)
+		switch {
+		case !ok:
+			continue
+		case !found:
+			from, to, found = t, t, true
+		case t.Before(from):
+			from = t
+		case t.After(to):
+			to = t
+		}
+	}
+	if !found {
+		return suggestDateMin, suggestDateMax // No sample is a date
+	}
+	return from, to
+}
+
+// numericRange returns the analyzed min and max of a numeric column, and whether they are integers.
+func numericRange(metric AnalyzeColumn) (float64, float64, bool, bool) {
+	min, minOK := toFloat(metric.MainMetric.Min)
+	max, maxOK := toFloat(metric.MainMetric.Max)
+	if !minOK || !maxOK {
+		return 0, 0, false, false
+	}
+	integer := min == float64(int64(min)) && max == float64(int64(max))
+	for _, sample := range metric.MainMetric.Samples {
+		if value, ok := toFloat(sample); ok && value != float64(int64(value)) {
+			integer = false
+		}
+	}
+	return min, max, integer, true
+}
+
+// toFloat converts a YAML number.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// charClass returns the regular expression class of a character kind, "" for other characters.
+func charClass(r rune) string {
+	switch {
+	case r >= '0' && r <= '9':
+		return "[0-9]"
+	case r >= 'a' && r <= 'z':
+		return "[a-z]"
+	case r >= 'A' && r <= 'Z':
+		return "[A-Z]"
+	}
+	return ""
+}
+
+// sampleShape renders a value as a regular expression of its format, e.g. "[0-9]{3}-[0-9]{4}" for "608-5551".
+func sampleShape(value string) string {
+	var sb strings.Builder
+	runes := []rune(value)
+	for i := 0; i < len(runes); {
+		class := charClass(runes[i])
+		same := func(r rune) bool { return class != "" && charClass(r) == class || class == "" && r == runes[i] }
+		n := 1
+		for i+n < len(runes) && same(runes[i+n]) {
+			n++
+		}
+		token := class
+		if token == "" {
+			token = regexp.QuoteMeta(string(runes[i]))
+		}
+		sb.WriteString(token)
+		if n > 1 {
+			fmt.Fprintf(&sb, "{%d}", n)
+		}
+		i += n
+	}
+	return sb.String()
+}
+
+// samplesRegex proposes a regular expression generating values like the analyzed ones:
+// their common format if they all share it, else their characters within the observed lengths.
+func samplesRegex(samples []string, metric StringMetric) string {
+	shape := sampleShape(samples[0])
+	if allMatch(samples, func(v string) bool { return sampleShape(v) == shape }) {
+		return shape
+	}
+
+	minLen, maxLen := metric.MinLen, metric.MaxLen
+	if maxLen == 0 {
+		minLen, maxLen = len([]rune(samples[0])), 0
+		for _, sample := range samples {
+			minLen, maxLen = min(minLen, len([]rune(sample))), max(maxLen, len([]rune(sample)))
+		}
+	}
+	length := fmt.Sprintf("{%d,%d}", minLen, maxLen)
+	if minLen == maxLen {
+		length = fmt.Sprintf("{%d}", minLen)
+	}
+	return "[" + sampleCharset(samples) + "]" + length
+}
+
+// sampleCharset returns the content of a regular expression class matching every character of the samples.
+func sampleCharset(samples []string) string {
+	ranges := map[string]bool{}
+	others := map[rune]bool{}
+	for _, sample := range samples {
+		for _, r := range sample {
+			if class := charClass(r); class != "" {
+				ranges[class[1:4]] = true
+			} else {
+				others[r] = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, class := range []string{"A-Z", "a-z", "0-9"} {
+		if ranges[class] {
+			sb.WriteString(class)
+		}
+	}
+	extra := make([]rune, 0, len(others))
+	for r := range others {
+		extra = append(extra, r)
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	for _, r := range extra {
+		if strings.ContainsRune(`\]^-[`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// sampleDomain returns the ff1 domain covering the characters of the samples, alphanumeric by default.
+// Other characters observed, like the separators of "AB-12", are part of the domain too: ff1 fails on
+// a value with a character out of its domain.
+func sampleDomain(samples []string) string {
+	ranges := map[string]bool{}
+	others := map[rune]bool{}
+	for _, sample := range samples {
+		for _, r := range sample {
+			if class := charClass(r); class != "" {
+				ranges[class] = true
+			} else {
+				others[r] = true
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		ranges = map[string]bool{"[0-9]": true, "[a-z]": true, "[A-Z]": true}
+	}
+
+	var sb strings.Builder
+	if ranges["[0-9]"] {
+		sb.WriteString("0123456789")
+	}
+	if ranges["[a-z]"] {
+		sb.WriteString("abcdefghijklmnopqrstuvwxyz")
+	}
+	if ranges["[A-Z]"] {
+		sb.WriteString("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	}
+	for _, r := range slices.Sorted(maps.Keys(others)) {
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// isEmptyMask tells whether a mask value is left to fill, like the boilerplate "mask:" followed by comments.
+func isEmptyMask(value *yaml.Node) bool {
+	return value.Kind == yaml.ScalarNode && value.Tag == "!!null" ||
+		value.Kind == yaml.MappingNode && len(value.Content) == 0
+}
+
+// applyMaskSuggestions writes the suggested masks into the rules of a masking file whose mask is empty.
+// Rules already masked are never changed. The caches of the key masks are declared when missing.
+func applyMaskSuggestions(content []byte, suggestions []MaskSuggestion) ([]byte, []string, []string, error) {
+	applied, skipped := []string{}, []string{}
+	doc, err := parseYAMLDocument(content)
+	if err != nil {
+		return nil, applied, skipped, err
+	}
+
+	byColumn := make(map[string]MaskSuggestion, len(suggestions))
+	for _, suggestion := range suggestions {
+		byColumn[suggestion.Column] = suggestion
+	}
+
+	// Fill the rules from the bottom so that line numbers stay valid.
+	caches := []string{}
+	seq := mappingValue(doc.root, "masking")
+	if isBlockSequence(seq) {
+		for i := len(seq.Content) - 1; i >= 0; i-- {
+			item := seq.Content[i]
+			column := ruleColumnPath(item)
+			suggestion, ok := byColumn[column]
+			if !ok {
+				continue // Sub-field selectors and columns not in the table
+			}
+			key, value := mappingEntry(item, "mask")
+			if suggestion.Mask == nil || key == nil || mappingValue(item, "masks") != nil || !isEmptyMask(value) {
+				skipped = append(skipped, column)
+				continue
+			}
+
+			lines, err := entryLines(key.Column-1, "mask", suggestion.Mask)
+			if err != nil {
+				return nil, applied, skipped, err
+			}
+			// The boilerplate comment under the empty mask is replaced, other comments are kept under the mask.
+			_, itemEnd := doc.itemLines(seq, i)
+			start, end := key.Line-1, key.Line
+			for end < itemEnd && isBlankOrComment(doc.lines[end]) && indentOf(doc.lines[end]) > key.Column-1 {
+				if strings.TrimSpace(doc.lines[end]) != `# regex: ""` {
+					lines = append(lines, doc.lines[end])
+				}
+				end++
+			}
+			if suggestion.Cache != "" && mappingValue(item, "cache") == nil {
+				lines = append(lines, fmt.Sprintf("%scache: %s", strings.Repeat(" ", key.Column-1), suggestion.Cache))
+				caches = append(caches, suggestion.Cache)
+			}
+			if err := doc.splice(start, end-start, lines...); err != nil {
+				return nil, applied, skipped, err
+			}
+			applied = append(applied, column)
+			seq = mappingValue(doc.root, "masking")
+		}
+	} else {
+		// No rules yet: the suggested masks are appended as new rules.
+		rules := []MaskSuggestion{}
+		for i := len(suggestions) - 1; i >= 0; i-- {
+			if suggestions[i].Mask == nil {
+				skipped = append(skipped, suggestions[i].Column)
+				continue
+			}
+			rules = append(rules, suggestions[i])
+			applied = append(applied, suggestions[i].Column)
+			if suggestions[i].Cache != "" {
+				caches = append(caches, suggestions[i].Cache)
+			}
+		}
+		slices.Reverse(rules)
+		if len(rules) > 0 {
+			err = doc.appendMaskingRules(func(indent int) []string {
+				pad := strings.Repeat(" ", indent)
+				var lines []string
+				for _, rule := range rules {
+					lines = append(lines, pad+"- selector:", fmt.Sprintf("%s    jsonpath: \"%s\"", pad, rule.Column))
+					entry, _ := entryLines(indent+2, "mask", rule.Mask)
+					lines = append(lines, entry...)
+					if rule.Cache != "" {
+						lines = append(lines, fmt.Sprintf("%s  cache: %s", pad, rule.Cache))
+					}
+				}
+				return lines
+			})
+			if err != nil {
+				return nil, applied, skipped, err
+			}
+		}
+	}
+	slices.Reverse(applied)
+	slices.Reverse(skipped)
+
+	slices.Sort(caches)
+	for _, name := range slices.Compact(caches) {
+		if err := doc.ensureCache(name); err != nil {
+			return nil, applied, skipped, err
+		}
+	}
+	return doc.bytes(), applied, skipped, nil
+}
+
+// ensureCache declares a unique cache in the "caches" mapping of a masking file, unless it already is.
+func (doc *yamlDocument) ensureCache(name string) error {
+	key, caches := mappingEntry(doc.root, "caches")
+	entry := func(indent int) []string {
+		pad := strings.Repeat(" ", indent)
+		return []string{pad + name + ":", pad + "  unique: true"}
+	}
+
+	switch {
+	case key == nil:
+		return doc.splice(len(doc.lines), 0, append([]string{"caches:"}, entry(2)...)...)
+	case mappingValue(caches, name) != nil:
+		return nil
+	case caches.Kind == yaml.MappingNode && len(caches.Content) > 0 && caches.Style&yaml.FlowStyle == 0 && key.Column == 1:
+		// Insert after the last line indented under the top-level "caches:" key.
+		end := key.Line
+		for line := key.Line; line < len(doc.lines); line++ {
+			text := doc.lines[line]
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if indentOf(text) == 0 {
+				break
+			}
+			end = line + 1
+		}
+		return doc.splice(end, 0, entry(caches.Content[0].Column-1)...)
+	case key.Column == 1 && isEmptyMask(caches):
+		return doc.splice(key.Line-1, 1, append([]string{"caches:"}, entry(2)...)...)
+	default:
+		return errors.New("'caches' is not a block mapping, the cache cannot be declared")
+	}
+}
+
+// suggestMaskHandler serves the mask suggestions of a table on GET, and writes them on POST
+// into the empty masks of its masking file, which is created when missing.
+func suggestMaskHandler(store *ProjectStore, ws *Workspace) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		folderName := chi.URLParam(r, "folder")
+		tableName := chi.URLParam(r, "table")
+		snap := store.Snapshot()
+
+		tableFolder, table, err := findTableLocation(snap.Data, tableName, folderName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		suggestions := suggestMasks(snap.Data[tableFolder], *table)
+
+		if r.Method == http.MethodGet {
+			w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+			if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+				log.Printf("Failed to encode mask suggestions to JSON: %v", err)
+			}
+			return
+		}
+
+		filePath, err := maskingFilePath(ws, tableFolder, tableName)
+		if err != nil {
+			http.Error(w, err.Error(), workspaceErrorStatus(err))
+			return
+		}
+		report := MaskSuggestReport{}
+		invalid := false
+		err = ws.UpdateFileAt(filePath, func(content []byte, exists bool) ([]byte, error) {
+			if !exists {
+				content, report.Created = newMaskingFile(*table), true
+			}
+			updated, applied, skipped, err := applyMaskSuggestions(content, suggestions)
+			report.Applied, report.Skipped, invalid = applied, skipped, err != nil
+			return updated, err
+		})
+		if err != nil {
+			status := workspaceErrorStatus(err)
+			if invalid {
+				status = http.StatusUnprocessableEntity
+			}
+			http.Error(w, fmt.Sprintf("Failed to write mask suggestions: %v", err), status)
+			return
+		}
+		report.File, _ = ws.RelPath(filePath)
+		log.Printf("Wrote %d mask suggestions into %s", len(report.Applied), filePath)
+
+		reloadSchemas(store)
+		w.Header().Set(CONTENT_TYPE, CONTENT_TYPE_JSON)
+		if report.Created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Failed to encode suggestion report to JSON: %v", err)
+		}
+	}
+}
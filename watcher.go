@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// fileStamp is the cheap fingerprint the watcher compares between two scans.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// projectWatcher polls the input paths and reloads the store once edits have settled.
+// Polling keeps nino dependency free and works the same on every OS and on network shares.
+type projectWatcher struct {
+	store    *ProjectStore
+	ws       *Workspace      // When set, masked JSONL files are analyzed as the target analysis of their folder.
+	interval time.Duration   // Delay between two scans.
+	debounce time.Duration   // Quiet period required after the last change before reloading.
+	analyzed map[string]bool // Folders whose target-analyze.yaml was written from their masked files.
+}
+
+func newProjectWatcher(store *ProjectStore, interval time.Duration) *projectWatcher {
+	return &projectWatcher{store: store, interval: interval, debounce: interval / 2}
+}
+
+// run scans forever. It is meant to be started in its own goroutine.
+func (pw *projectWatcher) run() {
+	log.Printf("Watching %v for changes every %s", pw.store.inputPaths, pw.interval)
+	previous, _ := pw.scan()
+	previousMasked, _ := pw.scanMasked()
+	// The masked files already there are analyzed once at startup.
+	pending, pendingMasked := false, len(previousMasked) > 0
+	var lastChange time.Time
+
+	ticker := time.NewTicker(pw.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// A failed listing skips the tick, instead of being seen as the removal of every file.
+		if current, err := pw.scan(); err == nil {
+			if changed := diffStamps(previous, current); len(changed) > 0 {
+				log.Printf("Watcher detected changes in %v", changed)
+				pending = true
+				lastChange = time.Now()
+			}
+			previous = current
+		}
+
+		if currentMasked, err := pw.scanMasked(); err == nil {
+			if changed := diffStamps(previousMasked, currentMasked); len(changed) > 0 {
+				log.Printf("Watcher detected masked files changes in %v", changed)
+				pendingMasked = true
+				lastChange = time.Now()
+			}
+			previousMasked = currentMasked
+		}
+
+		// Editors often write a file in several steps: wait for the burst to end.
+		if time.Since(lastChange) < pw.debounce {
+			continue
+		}
+		if pendingMasked {
+			// The target analyses written are reloaded at the next scan.
+			pendingMasked = false
+			pw.refreshTargetAnalyses()
+		}
+		if pending {
+			pending = false
+			reloadSchemas(pw.store)
+		}
+	}
+}
+
+// scanMasked stats every masked JSONL file below the input paths, when target analyses are refreshed.
+func (pw *projectWatcher) scanMasked() (map[string]fileStamp, error) {
+	if pw.ws == nil {
+		return make(map[string]fileStamp), nil
+	}
+	fileMap, err := findFiles(pw.store.inputPaths, SUFFIX_MASKED_JSONL)
+	if err != nil {
+		log.Printf("Watcher failed to list masked files: %v", err)
+		return nil, err
+	}
+	return statFiles(fileMap), nil
+}
+
+// refreshTargetAnalyses analyzes the masked JSONL files of each folder as its target-analyze.yaml.
+// The target-analyze.yaml written for a folder whose masked files were all deleted since is removed.
+func (pw *projectWatcher) refreshTargetAnalyses() {
+	fileMap, err := findFiles(pw.store.inputPaths, SUFFIX_MASKED_JSONL)
+	if err != nil {
+		log.Printf("Watcher failed to list masked files: %v", err)
+		return
+	}
+	folders := make(map[string][]string)
+	for file, basePath := range fileMap {
+		dir, err := filepath.Abs(folderDir(file, basePath))
+		if err != nil {
+			log.Printf("Watcher failed to locate the folder of %s: %v", file, err)
+			continue
+		}
+		folders[dir] = append(folders[dir], file)
+	}
+	if pw.analyzed == nil {
+		pw.analyzed = make(map[string]bool)
+	}
+	for dir, files := range folders {
+		sort.Strings(files)
+		if _, err := refreshTargetAnalysis(pw.ws, dir, files); err != nil {
+			log.Printf("Watcher failed to analyze the masked files of %s: %v", dir, err)
+			continue
+		}
+		pw.analyzed[dir] = true
+		log.Printf("Watcher analyzed %d masked files as the target analysis of %s", len(files), dir)
+	}
+	for dir := range pw.analyzed {
+		if _, ok := folders[dir]; ok {
+			continue
+		}
+		delete(pw.analyzed, dir)
+		relPath, ok := pw.ws.RelPath(filepath.Join(dir, TARGET_ANALYZE_FILE))
+		if !ok {
+			continue
+		}
+		if _, err := pw.ws.Remove(relPath, false); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Watcher failed to remove the target analysis of %s: %v", dir, err)
+			continue
+		}
+		log.Printf("Watcher removed the target analysis of %s, which has no masked files left", dir)
+	}
+}
+
+// scan stats every schema file below the input paths.
+func (pw *projectWatcher) scan() (map[string]fileStamp, error) {
+	fileMap, err := findSchemaFiles(pw.store.inputPaths)
+	if err != nil {
+		log.Printf("Watcher failed to list files: %v", err)
+		return nil, err
+	}
+	return statFiles(fileMap), nil
+}
+
+// statFiles stats the files found by a scan.
+func statFiles(fileMap map[string]string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for file := range fileMap {
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
+
+// diffStamps returns the files that were added, removed or modified between two scans.
+func diffStamps(previous, current map[string]fileStamp) []string {
+	var changed []string
+	for file, stamp := range current {
+		if old, ok := previous[file]; !ok || old.size != stamp.size || !old.modTime.Equal(stamp.modTime) {
+			changed = append(changed, file)
+		}
+	}
+	for file := range previous {
+		if _, ok := current[file]; !ok {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// errOutsideWorkspace is returned for any path that would leave the workspace.
+	errOutsideWorkspace = errors.New("path is outside of the workspace")
+	// errNotInWorkspace is returned when no input path contains the requested file.
+	errNotInWorkspace = errors.New("file not found in any configured input path")
+	// errWorkspaceRoot is returned when trying to delete or move an input path itself.
+	errWorkspaceRoot = errors.New("input paths themselves cannot be deleted or moved")
+	// errIntoItself is returned when moving or copying a folder inside itself.
+	errIntoItself = errors.New("cannot move or copy a folder into itself")
+	// errModified is returned when a conditional write finds a file changed since it was read.
+	errModified = errors.New("file was modified since it was read")
+)
+
+// workspaceRoot is one input path given on the command line.
+type workspaceRoot struct {
+	name string // Top-level name in workspace paths, "" when the input is the current directory
+	dir  string // Absolute directory, with symlinks evaluated
+	file string // For a single file input, the only file exposed from dir
+}
+
+// Workspace is the only way handlers touch the filesystem. It maps the slash separated
+// paths used by the API (e.g. "petstore/source/analyze.yaml") onto the input paths,
+// and guarantees that no read or write escapes them, including through symlinks.
+type Workspace struct {
+	roots []workspaceRoot
+	mu    sync.Mutex // Serializes writes, so that checking an ETag and writing is atomic
+}
+
+// newWorkspace creates a workspace rooted at the given input paths.
+func newWorkspace(inputPaths []string) (*Workspace, error) {
+	ws := &Workspace{}
+	for _, path := range inputPaths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", path, err)
+		}
+		real, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", path, err)
+		}
+		info, err := os.Stat(real)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", path, err)
+		}
+
+		root := workspaceRoot{name: filepath.Base(filepath.Clean(path)), dir: real}
+		if !info.IsDir() {
+			root.dir, root.file = filepath.Dir(real), filepath.Base(real)
+			root.name = root.file
+		} else if root.name == "." {
+			// The current directory is flattened into the workspace, as in /api/files.
+			root.name = ""
+		}
+		ws.roots = append(ws.roots, root)
+	}
+	return ws, nil
+}
+
+// Resolve returns the absolute path of a workspace path, which may not exist yet.
+// Existing files win over new ones, so that a path is resolved the same way by every handler.
+func (ws *Workspace) Resolve(relPath string) (string, error) {
+	candidates, err := ws.candidates(relPath)
+	if err != nil {
+		return "", err
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Lstat(candidate.path); err == nil {
+			return ws.contain(candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", errNotInWorkspace
+	}
+	return ws.contain(candidates[0])
+}
+
+// ResolveExisting returns the absolute path of an existing file or folder of the workspace.
+func (ws *Workspace) ResolveExisting(relPath string) (string, error) {
+	fullPath, err := ws.Resolve(relPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(fullPath); err != nil {
+		return "", fmt.Errorf("file '%s': %w", relPath, errNotInWorkspace)
+	}
+	return fullPath, nil
+}
+
+// ReadFile reads a workspace file.
+func (ws *Workspace) ReadFile(relPath string) ([]byte, error) {
+	fullPath, err := ws.ResolveExisting(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(fullPath)
+}
+
+// WriteFile writes a workspace file, creating its parent folders if needed.
+func (ws *Workspace) WriteFile(relPath string, content []byte) (string, error) {
+	fullPath, err := ws.Resolve(relPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return "", err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return fullPath, ws.replaceFile(fullPath, content)
+}
+
+// WriteFileAt writes a file given by its absolute path, as returned by FolderDir.
+// An existing file is only replaced when overwrite is set.
+func (ws *Workspace) WriteFileAt(fullPath string, content []byte, overwrite bool) error {
+	if !ws.Contains(fullPath) {
+		return errOutsideWorkspace
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, err := os.Lstat(fullPath); err == nil && !overwrite {
+		return fmt.Errorf("file '%s': %w", filepath.Base(fullPath), fs.ErrExist)
+	}
+	return ws.replaceFile(fullPath, content)
+}
+
+// UpdateFileAt reads, transforms and writes back a file given by its absolute path, as returned by FolderDir,
+// with no other write in between. update receives nil content for a missing file. Nothing is written
+// when update returns the content unchanged.
+func (ws *Workspace) UpdateFileAt(fullPath string, update func(content []byte, exists bool) ([]byte, error)) error {
+	if !ws.Contains(fullPath) {
+		return errOutsideWorkspace
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	content, err := os.ReadFile(fullPath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	updated, err := update(content, exists)
+	if err != nil {
+		return err
+	}
+	if exists && bytes.Equal(updated, content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return ws.replaceFile(fullPath, updated)
+}
+
+// WriteFileIfMatch writes an existing workspace file only if its current content still has
+// one of the ETags listed in ifMatch ("*" matches any content). When it does not,
+// the current content is returned along with errModified.
+func (ws *Workspace) WriteFileIfMatch(relPath string, content []byte, ifMatch string) (string, []byte, error) {
+	fullPath, err := ws.ResolveExisting(relPath)
+	if err != nil {
+		return "", nil, err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	current, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if !etagMatches(ifMatch, contentETag(current)) {
+		return fullPath, current, errModified
+	}
+	return fullPath, nil, ws.replaceFile(fullPath, content)
+}
+
+// replaceFile saves the current content of a file as a revision, then writes the new one. ws.mu must be held.
+func (ws *Workspace) replaceFile(fullPath string, content []byte) error {
+	if err := ws.saveRevision(fullPath); err != nil {
+		return fmt.Errorf("failed to save revision: %w", err)
+	}
+	return writeFileAtomic(fullPath, content)
+}
+
+// MkdirAll creates a workspace folder and its parents.
+func (ws *Workspace) MkdirAll(relPath string) (string, error) {
+	fullPath, err := ws.Resolve(relPath)
+	if err != nil {
+		return "", err
+	}
+	return fullPath, os.MkdirAll(fullPath, 0755)
+}
+
+// Remove deletes a workspace file. Folders are only deleted when empty, unless recursive is set.
+func (ws *Workspace) Remove(relPath string, recursive bool) (string, error) {
+	fullPath, err := ws.resolveMovable(relPath)
+	if err != nil {
+		return "", err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if err := ws.saveRevisions(fullPath); err != nil {
+		return "", fmt.Errorf("failed to save revision: %w", err)
+	}
+	if recursive {
+		return fullPath, os.RemoveAll(fullPath)
+	}
+	return fullPath, os.Remove(fullPath)
+}
+
+// Rename moves a workspace file or folder, creating the destination folders if needed.
+// An existing destination is never overwritten.
+func (ws *Workspace) Rename(fromPath, toPath string) (string, error) {
+	from, to, err := ws.resolvePair(fromPath, toPath)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return "", err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if err := os.Rename(from, to); err != nil {
+		return "", err
+	}
+	// The revisions follow the file.
+	ws.moveHistory(from, to)
+	return to, nil
+}
+
+// Copy duplicates a workspace file, or a folder recursively, keeping the permissions of the files.
+// Symlinks are not copied. An existing destination is never overwritten.
+func (ws *Workspace) Copy(fromPath, toPath string) (string, error) {
+	from, to, err := ws.resolvePair(fromPath, toPath)
+	if err != nil {
+		return "", err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	err = filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type().IsRegular():
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return writeFileAtomicPerm(target, content, info.Mode().Perm())
+		}
+		return nil
+	})
+	return to, err
+}
+
+// resolveMovable resolves an existing path which is not an input path itself.
+func (ws *Workspace) resolveMovable(relPath string) (string, error) {
+	fullPath, err := ws.ResolveExisting(relPath)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range ws.roots {
+		if fullPath == root.dir || (root.file != "" && fullPath == filepath.Join(root.dir, root.file)) {
+			return "", errWorkspaceRoot
+		}
+	}
+	return fullPath, nil
+}
+
+// resolvePair resolves the source and the not yet existing destination of a move or a copy.
+func (ws *Workspace) resolvePair(fromPath, toPath string) (string, string, error) {
+	from, err := ws.resolveMovable(fromPath)
+	if err != nil {
+		return "", "", err
+	}
+	to, err := ws.Resolve(toPath)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return "", "", fmt.Errorf("destination '%s': %w", toPath, fs.ErrExist)
+	}
+	if to == from || strings.HasPrefix(to, from+string(os.PathSeparator)) {
+		return "", "", fmt.Errorf("'%s': %w", fromPath, errIntoItself)
+	}
+	return from, to, nil
+}
+
+// RelPath returns the workspace path of an absolute path, the reverse of Resolve.
+func (ws *Workspace) RelPath(fullPath string) (string, bool) {
+	for _, root := range ws.roots {
+		rel, err := filepath.Rel(root.dir, fullPath)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case root.file != "":
+			if rel == root.file {
+				return rel, true
+			}
+		case root.name == "":
+			return rel, true
+		default:
+			return root.name + "/" + rel, true
+		}
+	}
+	return "", false
+}
+
+// FolderDir returns the directory holding the files of a project folder, as keyed by inferAllSchemas.
+func (ws *Workspace) FolderDir(folderName string) (string, error) {
+	for _, root := range ws.roots {
+		if root.file != "" {
+			if filepath.Base(root.dir) == folderName {
+				return root.dir, nil
+			}
+			continue
+		}
+		if root.name == folderName {
+			return root.dir, nil
+		}
+		if info, err := os.Stat(filepath.Join(root.dir, folderName)); err == nil && info.IsDir() {
+			return ws.contain(workspaceCandidate{root: root, path: filepath.Join(root.dir, folderName)})
+		}
+	}
+	return "", fmt.Errorf("folder '%s': %w", folderName, errNotInWorkspace)
+}
+
+// Contains tells whether an absolute path, once symlinks are evaluated, stays in the workspace.
+func (ws *Workspace) Contains(fullPath string) bool {
+	for _, root := range ws.roots {
+		if _, err := ws.contain(workspaceCandidate{root: root, path: fullPath}); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceCandidate is a possible location of a workspace path inside a given root.
+type workspaceCandidate struct {
+	root workspaceRoot
+	path string
+}
+
+// candidates lists where a workspace path may live, after rejecting absolute and parent paths.
+func (ws *Workspace) candidates(relPath string) ([]workspaceCandidate, error) {
+	relPath = strings.TrimPrefix(filepath.ToSlash(relPath), "/")
+	if relPath == "" || strings.ContainsRune(relPath, 0) || filepath.IsAbs(relPath) || filepath.VolumeName(relPath) != "" {
+		return nil, errOutsideWorkspace
+	}
+	for _, segment := range strings.Split(relPath, "/") {
+		// The history folder is only reachable through the file history API.
+		if segment == ".." || segment == HISTORY_DIR {
+			return nil, errOutsideWorkspace
+		}
+	}
+	cleanPath := filepath.Clean(filepath.FromSlash(relPath))
+	first, rest, _ := strings.Cut(filepath.ToSlash(cleanPath), "/")
+
+	var candidates []workspaceCandidate
+	for _, root := range ws.roots {
+		switch {
+		case root.file != "":
+			if cleanPath == root.file {
+				candidates = append(candidates, workspaceCandidate{root, filepath.Join(root.dir, root.file)})
+			}
+		case root.name == "":
+			candidates = append(candidates, workspaceCandidate{root, filepath.Join(root.dir, cleanPath)})
+		case first == root.name:
+			candidates = append(candidates, workspaceCandidate{root, filepath.Join(root.dir, filepath.FromSlash(rest))})
+		}
+	}
+	// Paths relative to a named input folder itself are still accepted, e.g. "tables.yaml" for "./petstore".
+	for _, root := range ws.roots {
+		if root.file == "" && root.name != "" {
+			candidates = append(candidates, workspaceCandidate{root, filepath.Join(root.dir, cleanPath)})
+		}
+	}
+	return candidates, nil
+}
+
+// contain evaluates the symlinks of a candidate (or of its closest existing parent
+// for a new file) and checks the result is still inside its root.
+func (ws *Workspace) contain(candidate workspaceCandidate) (string, error) {
+	existing, missing := candidate.path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", errOutsideWorkspace
+		}
+		missing = filepath.Join(filepath.Base(existing), missing)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	real = filepath.Join(real, missing)
+
+	rel, err := filepath.Rel(candidate.root.dir, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) || filepath.IsAbs(rel) {
+		return "", errOutsideWorkspace
+	}
+	if candidate.root.file != "" && rel != candidate.root.file {
+		return "", errOutsideWorkspace
+	}
+	return real, nil
+}
+
+// writeFileAtomic replaces a file through a temporary file and a rename, so that readers
+// (the watcher, another request) never see a partially written file.
+func writeFileAtomic(fullPath string, content []byte) error {
+	perm := fs.FileMode(0644)
+	if info, err := os.Stat(fullPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return writeFileAtomicPerm(fullPath, content, perm)
+}
+
+// writeFileAtomicPerm replaces a file like writeFileAtomic, giving it the permissions perm.
+func writeFileAtomicPerm(fullPath string, content []byte, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fullPath)
+}
+
+// contentETag returns the strong ETag of a file content.
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches tells whether an If-Match header value matches etag, using the strong comparison.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceErrorStatus maps workspace errors onto HTTP status codes.
+func workspaceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errOutsideWorkspace), errors.Is(err, errWorkspaceRoot):
+		return http.StatusForbidden
+	case errors.Is(err, errIntoItself):
+		return http.StatusBadRequest
+	case errors.Is(err, errModified):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, fs.ErrExist):
+		return http.StatusConflict
+	case errors.Is(err, errNotInWorkspace), errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}